@@ -0,0 +1,110 @@
+// Command fair-replay feeds a recording written by tracker.RecordingTracker
+// into a fresh tracker with a fake clock and prints every decision next to the
+// recorded one as CSV. Use it after an incident to see which final
+// probability a client was throttled at and whether the replay agrees.
+//
+// Usage:
+//
+//	go run ./cmd/fair-replay -recording fair.log -config fair.yaml [-client customer-x] [-out decisions.csv]
+//
+// The config must be the one the recording was made with, including
+// hash_seed, for the probabilities to be reproduced exactly. If it sets
+// privacy_salt, the recording holds salted hashes of the clients and -client
+// takes the raw identifier, which is hashed with the salt to find it.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/tracker"
+)
+
+func main() {
+	recordingPath := flag.String("recording", "", "path to the recording to replay")
+	configPath := flag.String("config", "", "path to the YAML or JSON tracker config the recording was made with")
+	client := flag.String("client", "", "only print the decisions of this client (default: all clients)")
+	outPath := flag.String("out", "", "path to write the CSV results to (default: stdout)")
+	flag.Parse()
+
+	if err := run(*recordingPath, *configPath, *client, *outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "fair-replay: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(recordingPath, configPath, client, outPath string) error {
+	if recordingPath == "" {
+		return fmt.Errorf("-recording is required")
+	}
+	if configPath == "" {
+		return fmt.Errorf("-config is required")
+	}
+
+	conf, err := config.LoadConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	if client != "" && len(conf.PrivacySalt) > 0 {
+		client = string(tracker.PrivateClientIdentifier(conf.PrivacySalt, []byte(client)))
+	}
+
+	recording, err := os.Open(recordingPath)
+	if err != nil {
+		return err
+	}
+	defer recording.Close()
+
+	decisions, err := tracker.Replay(recording, conf)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return writeCSV(out, decisions, client)
+}
+
+// Write one row per decision, keeping only the given client if set
+func writeCSV(out io.Writer, decisions []tracker.ReplayedDecision, client string) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"time", "client", "recorded_probability", "replayed_probability", "recorded_throttled", "replayed_throttled", "recorded_shadow_throttled", "replayed_shadow_throttled"}); err != nil {
+		return err
+	}
+
+	for _, d := range decisions {
+		if client != "" && string(d.ClientIdentifier) != client {
+			continue
+		}
+		if err := w.Write([]string{
+			d.Time.Format(time.RFC3339Nano),
+			string(d.ClientIdentifier),
+			strconv.FormatFloat(d.RecordedProbability, 'f', -1, 64),
+			strconv.FormatFloat(d.ReplayedProbability, 'f', -1, 64),
+			strconv.FormatBool(d.RecordedThrottled),
+			strconv.FormatBool(d.ReplayedThrottled),
+			strconv.FormatBool(d.RecordedShadowThrottled),
+			strconv.FormatBool(d.ReplayedShadowThrottled),
+		}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/tracker"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "fair.yaml")
+	// Without decay the probabilities don't depend on the real clock the
+	// recording is made with
+	require.NoError(t, os.WriteFile(configPath, []byte("hash_seed: 7\npi: 0.5\npd: 0.1\nlambda: 0\n"), 0o600))
+	conf, err := config.LoadConfigFile(configPath)
+	require.NoError(t, err)
+
+	var recording bytes.Buffer
+	rt, err := tracker.NewRecordingTracker(conf, &recording)
+	require.NoError(t, err)
+	ctx := context.Background()
+	rt.ReportOutcome(ctx, []byte("customer-x"), request.OutcomeFailure)
+	rt.RegisterRequest(ctx, []byte("customer-x"))
+	rt.RegisterRequest(ctx, []byte("customer-y"))
+	rt.Close()
+	recordingPath := filepath.Join(dir, "fair.log")
+	require.NoError(t, os.WriteFile(recordingPath, recording.Bytes(), 0o600))
+	outPath := filepath.Join(dir, "decisions.csv")
+
+	err = run(recordingPath, configPath, "customer-x", outPath)
+
+	require.NoError(t, err)
+	out, err := os.Open(outPath)
+	require.NoError(t, err)
+	defer out.Close()
+	rows, err := csv.NewReader(out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2, "only the header and the decision of the client should be printed")
+	require.Equal(t, "customer-x", rows[1][1])
+	recorded, err := strconv.ParseFloat(rows[1][2], 64)
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, recorded, 1e-3)
+	require.Equal(t, rows[1][2], rows[1][3], "the replay should reproduce the probability")
+}
+
+func TestRun_MissingFlags(t *testing.T) {
+	require.Error(t, run("", "fair.yaml", "", ""))
+	require.Error(t, run("fair.log", "", "", ""))
+}
+
+func TestRun_PrivacySalt(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "fair.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("hash_seed: 7\nprivacy_salt: salt\n"), 0o600))
+	conf, err := config.LoadConfigFile(configPath)
+	require.NoError(t, err)
+
+	var recording bytes.Buffer
+	rt, err := tracker.NewRecordingTracker(conf, &recording)
+	require.NoError(t, err)
+	ctx := context.Background()
+	rt.RegisterRequest(ctx, []byte("customer-x"))
+	rt.RegisterRequest(ctx, []byte("customer-y"))
+	rt.Close()
+	recordingPath := filepath.Join(dir, "fair.log")
+	require.NoError(t, os.WriteFile(recordingPath, recording.Bytes(), 0o600))
+	outPath := filepath.Join(dir, "decisions.csv")
+
+	err = run(recordingPath, configPath, "customer-x", outPath)
+
+	require.NoError(t, err)
+	out, err := os.Open(outPath)
+	require.NoError(t, err)
+	defer out.Close()
+	rows, err := csv.NewReader(out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2, "the client should be found by its raw identifier")
+	require.Equal(t, string(tracker.PrivateClientIdentifier([]byte("salt"), []byte("customer-x"))), rows[1][1])
+}
@@ -0,0 +1,63 @@
+// Command fair-sim runs a simulated workload against a fairness tracker using
+// a fake clock and prints per-client throttle rates and convergence times as
+// CSV. Use it to validate tuning before rolling a config out to production.
+//
+// Usage:
+//
+//	go run ./cmd/fair-sim -scenario scenario.yaml [-config fair.yaml] [-out results.csv]
+//
+// When -config is set, the tracker config is read from that YAML or JSON file
+// instead of being generated from the tracker section of the scenario.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	scenarioPath := flag.String("scenario", "", "path to the YAML scenario file")
+	configPath := flag.String("config", "", "path to a YAML or JSON tracker config file (default: generated from the scenario)")
+	outPath := flag.String("out", "", "path to write the CSV results to (default: stdout)")
+	flag.Parse()
+
+	if err := run(*scenarioPath, *configPath, *outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "fair-sim: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(scenarioPath, configPath, outPath string) error {
+	if scenarioPath == "" {
+		return fmt.Errorf("-scenario is required")
+	}
+
+	sc, err := LoadScenario(scenarioPath)
+	if err != nil {
+		return err
+	}
+
+	conf, err := trackerConfig(sc, configPath)
+	if err != nil {
+		return err
+	}
+
+	results, err := Simulate(sc, conf)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return WriteCSV(out, results, sc.Window, sc.ConvergenceTolerance)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario describes a simulated workload run against a tracker.
+type Scenario struct {
+	// Total simulated time
+	Duration time.Duration `yaml:"duration"`
+	// Width of the windows used to compute throttle rates over time
+	Window time.Duration `yaml:"window"`
+	// How close a window's throttle rate must stay to the steady-state rate for
+	// a client to be considered converged
+	ConvergenceTolerance float64 `yaml:"convergence_tolerance"`
+	// Seed for the random number generator driving failure injection, and for
+	// the hash seeds of the structures unless the config sets HashSeed
+	Seed int64 `yaml:"seed"`
+	// The shared resource the clients compete for
+	Resource ResourceSpec `yaml:"resource"`
+	// Parameters used to generate the tracker config
+	Tracker TrackerSpec `yaml:"tracker"`
+	// The client classes taking part in the simulation
+	Clients []ClientSpec `yaml:"clients"`
+}
+
+// ResourceSpec describes the shared resource as a token bucket. A request that
+// gets a token succeeds and one that doesn't fails.
+type ResourceSpec struct {
+	// Rate at which the resource regenerates
+	RatePerSecond float64 `yaml:"rate_per_second"`
+	// Maximum number of units that can accumulate
+	Burst float64 `yaml:"burst"`
+}
+
+// TrackerSpec holds the inputs to config.GenerateTunedConfig. When
+// ExpectedClients is zero, the default tracker config is used instead.
+type TrackerSpec struct {
+	ExpectedClients            uint64        `yaml:"expected_clients"`
+	TolerableFalsePositiveRate float64       `yaml:"tolerable_false_positive_rate"`
+	RecoveryTime               time.Duration `yaml:"recovery_time"`
+}
+
+// ClientSpec describes a class of identical clients.
+type ClientSpec struct {
+	// Name of the class, used to label the clients in the output
+	Name string `yaml:"name"`
+	// Number of clients in the class
+	Count int `yaml:"count"`
+	// Requests per second sent by each client
+	RPS float64 `yaml:"rps"`
+	// Probability that an admitted request fails regardless of the resource,
+	// for example because the client sends expensive queries
+	FailureRate float64 `yaml:"failure_rate"`
+}
+
+// LoadScenario reads and validates a YAML scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	return ParseScenario(raw)
+}
+
+// ParseScenario parses and validates a YAML scenario.
+func ParseScenario(raw []byte) (*Scenario, error) {
+	sc := &Scenario{}
+	if err := yaml.Unmarshal(raw, sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+
+	if sc.Window == 0 {
+		sc.Window = 10 * time.Second
+	}
+	if sc.ConvergenceTolerance == 0 {
+		sc.ConvergenceTolerance = 0.1
+	}
+
+	if err := sc.validate(); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+func (sc *Scenario) validate() error {
+	if sc.Duration <= 0 {
+		return fmt.Errorf("duration must be greater than 0")
+	}
+	if sc.Window <= 0 || sc.Window > sc.Duration {
+		return fmt.Errorf("window must be in (0, duration], found: %v", sc.Window)
+	}
+	if sc.ConvergenceTolerance < 0 || sc.ConvergenceTolerance > 1 {
+		return fmt.Errorf("convergence_tolerance must be in [0, 1], found: %f", sc.ConvergenceTolerance)
+	}
+	if sc.Resource.RatePerSecond <= 0 || sc.Resource.Burst < 1 {
+		return fmt.Errorf("resource rate_per_second must be >0 and burst >=1")
+	}
+	if len(sc.Clients) == 0 {
+		return fmt.Errorf("at least one client class is required")
+	}
+
+	for _, c := range sc.Clients {
+		if c.Name == "" {
+			return fmt.Errorf("every client class needs a name")
+		}
+		if c.Count <= 0 || c.RPS <= 0 {
+			return fmt.Errorf("client class %q must have count and rps >0", c.Name)
+		}
+		if c.FailureRate < 0 || c.FailureRate > 1 {
+			return fmt.Errorf("client class %q failure_rate must be in [0, 1]", c.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/tracker"
+)
+
+// ClientResult holds the outcome of a simulation for a single client.
+type ClientResult struct {
+	Name       string
+	Class      string
+	Requests   int
+	Throttled  int
+	Successes  int
+	Failures   int
+	windows    []windowStat
+	interval   time.Duration
+	nextSendAt time.Duration
+	failRate   float64
+	heapIndex  int
+}
+
+type windowStat struct {
+	requests  int
+	throttled int
+}
+
+// ThrottleRate returns the fraction of the client's requests that were throttled.
+func (cr *ClientResult) ThrottleRate() float64 {
+	if cr.Requests == 0 {
+		return 0
+	}
+	return float64(cr.Throttled) / float64(cr.Requests)
+}
+
+// ConvergenceTime returns how long it took the client's windowed throttle rate
+// to settle within tolerance of its steady-state rate, measured over the last
+// quarter of the run, and stay there. It returns false if the rate never
+// settled.
+func (cr *ClientResult) ConvergenceTime(window time.Duration, tolerance float64) (time.Duration, bool) {
+	n := len(cr.windows)
+	tail := n / 4
+	if tail == 0 {
+		tail = 1
+	}
+
+	var steadyReq, steadyThr int
+	for _, w := range cr.windows[n-tail:] {
+		steadyReq += w.requests
+		steadyThr += w.throttled
+	}
+	if steadyReq == 0 {
+		return 0, false
+	}
+	steady := float64(steadyThr) / float64(steadyReq)
+
+	converged := n
+	for i := n - 1; i >= 0; i-- {
+		w := cr.windows[i]
+		if w.requests == 0 {
+			continue
+		}
+		if math.Abs(float64(w.throttled)/float64(w.requests)-steady) > tolerance {
+			break
+		}
+		converged = i
+	}
+
+	if converged == n {
+		return 0, false
+	}
+	return time.Duration(converged) * window, true
+}
+
+// A clock advanced manually by the simulator
+type simClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simClock) Sleep(d time.Duration) {
+	c.set(c.Now().Add(d))
+}
+
+func (c *simClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// A ticker fired by the simulator whenever simulated time crosses a rotation
+type simTicker struct {
+	ch chan time.Time
+}
+
+func (t *simTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *simTicker) Stop() {}
+
+func (t *simTicker) Reset(_ time.Duration) {}
+
+// Signals the simulator when a rotation is done
+type simObserver struct {
+	config.BaseObserver
+	rotations chan struct{}
+}
+
+func (o *simObserver) OnRotation(_, _ uint64) {
+	o.rotations <- struct{}{}
+}
+
+// The shared resource the clients compete for
+type resource struct {
+	tokens    float64
+	rate      float64
+	burst     float64
+	updatedAt time.Duration
+}
+
+func (r *resource) take(now time.Duration) bool {
+	r.tokens = math.Min(r.burst, r.tokens+r.rate*(now-r.updatedAt).Seconds())
+	r.updatedAt = now
+
+	if r.tokens >= 1 {
+		r.tokens--
+		return true
+	}
+	return false
+}
+
+// Clients ordered by the time of their next request
+type sendQueue []*ClientResult
+
+func (q sendQueue) Len() int           { return len(q) }
+func (q sendQueue) Less(i, j int) bool { return q[i].nextSendAt < q[j].nextSendAt }
+func (q sendQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].heapIndex = i
+	q[j].heapIndex = j
+}
+
+func (q *sendQueue) Push(x any) {
+	c := x.(*ClientResult)
+	c.heapIndex = len(*q)
+	*q = append(*q, c)
+}
+
+func (q *sendQueue) Pop() any {
+	old := *q
+	n := len(old)
+	c := old[n-1]
+	*q = old[:n-1]
+	return c
+}
+
+// Build the tracker config for the scenario, preferring the config file if given
+func trackerConfig(sc *Scenario, configPath string) (*config.FairnessTrackerConfig, error) {
+	if configPath != "" {
+		return config.LoadConfigFile(configPath)
+	}
+	if sc.Tracker.ExpectedClients == 0 {
+		return config.DefaultFairnessTrackerConfig(), nil
+	}
+	return config.GenerateTunedConfig(sc.Tracker.ExpectedClients, sc.Tracker.TolerableFalsePositiveRate, sc.Tracker.RecoveryTime)
+}
+
+// Simulate runs the scenario against a tracker built from conf and returns the
+// result for every client. The observer in the config is not called. Unless
+// the config sets HashSeed, the structures are seeded from the scenario seed,
+// so results are reproducible in the threshold decision mode. Probabilistic
+// decisions draw from the global random source and vary between runs.
+func Simulate(sc *Scenario, conf *config.FairnessTrackerConfig) ([]*ClientResult, error) {
+	start := time.Unix(0, 0)
+	clk := &simClock{now: start}
+	ticker := &simTicker{ch: make(chan time.Time)}
+	rotations := make(chan struct{})
+	configCopy := *conf
+	configCopy.Observer = &simObserver{rotations: rotations}
+	if configCopy.HashSeed == 0 {
+		// A zero HashSeed means random seeds
+		configCopy.HashSeed = uint32(uint64(sc.Seed)%math.MaxUint32) + 1
+	}
+
+	trk, err := tracker.NewFairnessTrackerWithClockAndTicker(&configCopy, clk, ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer trk.Close()
+
+	rng := rand.New(rand.NewSource(sc.Seed))
+	res := &resource{tokens: sc.Resource.Burst, rate: sc.Resource.RatePerSecond, burst: sc.Resource.Burst}
+	numWindows := int((sc.Duration + sc.Window - 1) / sc.Window)
+
+	var clients []*ClientResult
+	queue := &sendQueue{}
+	for _, spec := range sc.Clients {
+		interval := time.Duration(float64(time.Second) / spec.RPS)
+		for i := 0; i < spec.Count; i++ {
+			c := &ClientResult{
+				Name:     fmt.Sprintf("%s-%d", spec.Name, i),
+				Class:    spec.Name,
+				windows:  make([]windowStat, numWindows),
+				interval: interval,
+				// Spread the clients of a class evenly over one interval
+				nextSendAt: interval * time.Duration(i) / time.Duration(spec.Count),
+				failRate:   spec.FailureRate,
+			}
+			clients = append(clients, c)
+			heap.Push(queue, c)
+		}
+	}
+
+	ctx := context.Background()
+	nextRotation := conf.RotationFrequency
+	for queue.Len() > 0 {
+		c := (*queue)[0]
+		now := c.nextSendAt
+		if now >= sc.Duration {
+			break
+		}
+
+		for conf.RotationFrequency > 0 && now >= nextRotation {
+			clk.set(start.Add(nextRotation))
+			// Rotations happen in the background, so wait for it to finish
+			// before the next request sees the structures
+			ticker.ch <- clk.Now()
+			<-rotations
+			nextRotation += conf.RotationFrequency
+		}
+		clk.set(start.Add(now))
+
+		id := []byte(c.Name)
+		w := &c.windows[int(now/sc.Window)]
+		c.Requests++
+		w.requests++
+
+		if trk.RegisterRequest(ctx, id).ShouldThrottle {
+			c.Throttled++
+			w.throttled++
+		} else if res.take(now) && rng.Float64() >= c.failRate {
+			c.Successes++
+			trk.ReportOutcome(ctx, id, request.OutcomeSuccess)
+		} else {
+			c.Failures++
+			trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+		}
+
+		c.nextSendAt += c.interval
+		heap.Fix(queue, 0)
+	}
+
+	return clients, nil
+}
+
+// WriteCSV writes one row per client with its throttle rate and convergence time.
+func WriteCSV(out io.Writer, results []*ClientResult, window time.Duration, tolerance float64) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"client", "class", "requests", "throttled", "throttle_rate", "successes", "failures", "convergence_seconds"}); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		convergence := ""
+		if d, ok := r.ConvergenceTime(window, tolerance); ok {
+			convergence = strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+		}
+
+		if err := w.Write([]string{
+			r.Name,
+			r.Class,
+			strconv.Itoa(r.Requests),
+			strconv.Itoa(r.Throttled),
+			strconv.FormatFloat(r.ThrottleRate(), 'f', 4, 64),
+			strconv.Itoa(r.Successes),
+			strconv.Itoa(r.Failures),
+			convergence,
+		}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+)
+
+func TestParseScenario(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+duration: 1m
+seed: 7
+resource:
+  rate_per_second: 5
+  burst: 5
+tracker:
+  expected_clients: 1000
+  tolerable_false_positive_rate: 0.01
+  recovery_time: 30s
+clients:
+  - name: good
+    count: 3
+    rps: 0.5
+    failure_rate: 0.1
+`))
+
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, sc.Duration)
+	require.Equal(t, 10*time.Second, sc.Window)
+	require.Equal(t, 0.1, sc.ConvergenceTolerance)
+	require.Equal(t, int64(7), sc.Seed)
+	require.Equal(t, 30*time.Second, sc.Tracker.RecoveryTime)
+	require.Equal(t, []ClientSpec{{Name: "good", Count: 3, RPS: 0.5, FailureRate: 0.1}}, sc.Clients)
+}
+
+func TestParseScenario_Invalid(t *testing.T) {
+	valid := "duration: 1m\nresource: {rate_per_second: 1, burst: 1}\n"
+	testCases := map[string]string{
+		"malformed":            "duration: [",
+		"no duration":          "resource: {rate_per_second: 1, burst: 1}\nclients: [{name: a, count: 1, rps: 1}]",
+		"window over duration": valid + "window: 2m\nclients: [{name: a, count: 1, rps: 1}]",
+		"no resource":          "duration: 1m\nclients: [{name: a, count: 1, rps: 1}]",
+		"no clients":           valid,
+		"unnamed client":       valid + "clients: [{count: 1, rps: 1}]",
+		"zero count":           valid + "clients: [{name: a, count: 0, rps: 1}]",
+		"bad failure rate":     valid + "clients: [{name: a, count: 1, rps: 1, failure_rate: 2}]",
+		"bad tolerance":        valid + "convergence_tolerance: 2\nclients: [{name: a, count: 1, rps: 1}]",
+	}
+
+	for name, raw := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sc, err := ParseScenario([]byte(raw))
+
+			require.Error(t, err)
+			require.Nil(t, sc)
+		})
+	}
+}
+
+func TestSimulate_WithinCapacityIsNeverThrottled(t *testing.T) {
+	sc := &Scenario{
+		Duration: time.Minute,
+		Window:   10 * time.Second,
+		Resource: ResourceSpec{RatePerSecond: 10, Burst: 10},
+		Clients:  []ClientSpec{{Name: "good", Count: 4, RPS: 2}},
+	}
+
+	results, err := Simulate(sc, config.DefaultFairnessTrackerConfig())
+
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	for _, r := range results {
+		require.Equal(t, 120, r.Requests)
+		require.Zero(t, r.Throttled)
+		require.Zero(t, r.Failures)
+		require.Equal(t, 120, r.Successes)
+	}
+}
+
+func TestSimulate_InjectedFailuresThrottle(t *testing.T) {
+	sc := &Scenario{
+		Duration: time.Minute,
+		Window:   10 * time.Second,
+		Seed:     1,
+		Resource: ResourceSpec{RatePerSecond: 100, Burst: 100},
+		Clients:  []ClientSpec{{Name: "bad", Count: 1, RPS: 10, FailureRate: 1}},
+	}
+
+	results, err := Simulate(sc, config.DefaultFairnessTrackerConfig())
+
+	require.NoError(t, err)
+	require.Zero(t, results[0].Successes)
+	require.Greater(t, results[0].ThrottleRate(), 0.5)
+}
+
+func TestSimulate_DeterministicWithRotations(t *testing.T) {
+	sc := &Scenario{
+		Duration: time.Minute,
+		Window:   10 * time.Second,
+		Seed:     1,
+		Resource: ResourceSpec{RatePerSecond: 20, Burst: 20},
+		Clients: []ClientSpec{
+			{Name: "good", Count: 4, RPS: 2, FailureRate: 0.1},
+			{Name: "bad", Count: 2, RPS: 10, FailureRate: 0.8},
+		},
+	}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.RotationFrequency = 5 * time.Second
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.5
+
+	first, err := Simulate(sc, conf)
+	require.NoError(t, err)
+	for range 5 {
+		results, err := Simulate(sc, conf)
+
+		require.NoError(t, err)
+		require.Equal(t, first, results)
+	}
+}
+
+func TestConvergenceTime(t *testing.T) {
+	cr := &ClientResult{windows: []windowStat{
+		{requests: 10, throttled: 0},
+		{requests: 10, throttled: 9},
+		{requests: 10, throttled: 5},
+		{requests: 10, throttled: 6},
+		{requests: 0},
+		{requests: 10, throttled: 5},
+		{requests: 10, throttled: 5},
+		{requests: 10, throttled: 5},
+	}}
+
+	d, ok := cr.ConvergenceTime(time.Second, 0.1)
+
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, d)
+}
+
+func TestConvergenceTime_NoTraffic(t *testing.T) {
+	cr := &ClientResult{windows: make([]windowStat, 4)}
+
+	_, ok := cr.ConvergenceTime(time.Second, 0.1)
+
+	require.False(t, ok)
+}
+
+func TestWriteCSV(t *testing.T) {
+	results := []*ClientResult{
+		{Name: "good-0", Class: "good", Requests: 4, Throttled: 1, Successes: 2, Failures: 1, windows: []windowStat{{requests: 4, throttled: 1}}},
+		{Name: "idle-0", Class: "idle", windows: []windowStat{{}}},
+	}
+	var buf bytes.Buffer
+
+	err := WriteCSV(&buf, results, 10*time.Second, 0.1)
+
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"client,class,requests,throttled,throttle_rate,successes,failures,convergence_seconds",
+		"good-0,good,4,1,0.2500,2,1,0",
+		"idle-0,idle,0,0,0.0000,0,0,",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestRun_ExampleScenario(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "results.csv")
+
+	err := run("example.yaml", "", out)
+
+	require.NoError(t, err)
+	raw, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, 21, strings.Count(string(raw), "\n"))
+}
+
+func TestRun_ConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "fair.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("throttle_mode: shadow\n"), 0o600))
+	out := filepath.Join(dir, "results.csv")
+
+	err := run("example.yaml", configPath, out)
+
+	require.NoError(t, err)
+	raw, err := os.ReadFile(out)
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n")[1:] {
+		require.Equal(t, "0", strings.Split(line, ",")[3], "shadow mode should never throttle")
+	}
+
+	err = run("example.yaml", filepath.Join(dir, "missing.yaml"), out)
+	require.Error(t, err)
+}
@@ -0,0 +1,280 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/identity"
+	"github.com/satmihir/fair/pkg/logger"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+const (
+	defaultBatchSize      = 100
+	defaultFlushInterval  = time.Second
+	defaultBufferSize     = 10000
+	defaultPublishTimeout = 5 * time.Second
+)
+
+// Sink publishes messages to a topic or subject of a message bus. Adapters for
+// Kafka, NATS or any other client implement it, typically by sending the
+// payloads in a single produce call. The payloads must not be retained after
+// Publish returns.
+type Sink interface {
+	Publish(ctx context.Context, payloads [][]byte) error
+}
+
+// DecisionEvent is a throttle decision as published by a DecisionPublisher,
+// encoded as a JSON object.
+type DecisionEvent struct {
+	// When the decision was made
+	Time time.Time `json:"time"`
+	// The namespace set in the publisher config
+	Namespace string `json:"namespace,omitempty"`
+	// The hex-encoded HMAC-SHA256 of the throttled client identifier, keyed
+	// with the Salt of the publisher config
+	Client string `json:"client"`
+	// The final probability the decision was based on
+	FinalProbability float64 `json:"final_probability"`
+	// Whether the request was only throttled in the shadow throttle mode
+	Shadow bool `json:"shadow,omitempty"`
+	// Whether the request was throttled by the rate limit
+	RateLimited bool `json:"rate_limited,omitempty"`
+}
+
+// PublisherConfig configures a DecisionPublisher. Zero values use the
+// defaults.
+type PublisherConfig struct {
+	// The secret client identifiers are hashed with before they are published,
+	// so raw identifiers never reach the bus. Required. Compute the hash of a
+	// known client with tracker.PrivateClientIdentifier and this salt. If the
+	// tracker config sets PrivacySalt, the publisher receives identifiers that
+	// are already hashed with it and hashes them again.
+	Salt []byte
+	// Attached to every event, for example to tell services apart. Optional.
+	Namespace string
+	// Maximum number of events per Publish call. Defaults to 100.
+	BatchSize int
+	// How often a partial batch is published. Defaults to 1s.
+	FlushInterval time.Duration
+	// Number of events waiting to be published. Events arriving while the
+	// buffer is full are dropped, so a slow bus never slows decisions down.
+	// Defaults to 10000.
+	BufferSize int
+	// Number of times a failed batch is retried before it is dropped. Zero,
+	// the default, gives at-most-once delivery. Retries give at-least-once
+	// delivery for batches that fail after the bus accepted them.
+	Retries int
+	// Timeout of every Publish call. Defaults to 5s.
+	PublishTimeout time.Duration
+	// Receives every tracker event after the publisher. Optional.
+	Next config.Observer
+}
+
+// PublisherStats counts the events a DecisionPublisher has handled.
+type PublisherStats struct {
+	// Number of events published
+	Published uint64
+	// Number of events dropped because the buffer was full or the publisher
+	// was closed
+	Dropped uint64
+	// Number of events dropped because their batch failed to publish
+	Failed uint64
+}
+
+// DecisionPublisher publishes the throttle decisions of a tracker to a message
+// bus for analytics and anomaly detection. It is a config.Observer, so set it
+// as the Observer of the tracker config. Decisions are buffered and published
+// in batches from a background goroutine.
+type DecisionPublisher struct {
+	sink   Sink
+	conf   PublisherConfig
+	clock  utils.IClock
+	ticker utils.ITicker
+	hash   identity.Normalizer
+
+	events chan *DecisionEvent
+	// Guards closed, so no event is queued once Close started draining
+	mu     sync.RWMutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// NewDecisionPublisher creates a publisher sending decisions to the given sink
+// and starts its background goroutine. Close it after the tracker.
+func NewDecisionPublisher(sink Sink, conf PublisherConfig) (*DecisionPublisher, error) {
+	if len(conf.Salt) == 0 {
+		return nil, NewBridgeError(nil, "the publisher config must set a salt to hash client identifiers with").
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if conf.BatchSize < 0 || conf.FlushInterval < 0 || conf.BufferSize < 0 || conf.Retries < 0 || conf.PublishTimeout < 0 {
+		return nil, NewBridgeError(nil, "the publisher config must not have negative values, found: %+v", conf.withoutSalt()).
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if conf.BatchSize == 0 {
+		conf.BatchSize = defaultBatchSize
+	}
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+	if conf.BufferSize == 0 {
+		conf.BufferSize = defaultBufferSize
+	}
+	if conf.PublishTimeout == 0 {
+		conf.PublishTimeout = defaultPublishTimeout
+	}
+
+	return newDecisionPublisher(sink, conf, utils.NewRealClock(), utils.NewRealTicker(conf.FlushInterval)), nil
+}
+
+func newDecisionPublisher(sink Sink, conf PublisherConfig, clock utils.IClock, ticker utils.ITicker) *DecisionPublisher {
+	dp := &DecisionPublisher{
+		sink:   sink,
+		conf:   conf,
+		clock:  clock,
+		ticker: ticker,
+		hash:   identity.HMAC(conf.Salt),
+		events: make(chan *DecisionEvent, conf.BufferSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go dp.run()
+	return dp
+}
+
+// OnThrottle queues the decision for publishing, or drops it if the buffer is
+// full.
+func (dp *DecisionPublisher) OnThrottle(clientIdentifier []byte, result *request.RegisterRequestResult) {
+	event := &DecisionEvent{
+		Time:             dp.clock.Now(),
+		Namespace:        dp.conf.Namespace,
+		Client:           string(dp.hash(clientIdentifier)),
+		FinalProbability: result.FinalProbability,
+		Shadow:           result.ShadowThrottled,
+		RateLimited:      result.RateLimited,
+	}
+	dp.mu.RLock()
+	if dp.closed {
+		dp.dropped.Add(1)
+	} else {
+		select {
+		case dp.events <- event:
+		default:
+			dp.dropped.Add(1)
+		}
+	}
+	dp.mu.RUnlock()
+
+	if dp.conf.Next != nil {
+		dp.conf.Next.OnThrottle(clientIdentifier, result)
+	}
+}
+
+// OnRotation forwards the event to the next observer.
+func (dp *DecisionPublisher) OnRotation(retiredID, newID uint64) {
+	if dp.conf.Next != nil {
+		dp.conf.Next.OnRotation(retiredID, newID)
+	}
+}
+
+// Stats returns the number of events handled so far.
+func (dp *DecisionPublisher) Stats() PublisherStats {
+	return PublisherStats{
+		Published: dp.published.Load(),
+		Dropped:   dp.dropped.Load(),
+		Failed:    dp.failed.Load(),
+	}
+}
+
+// Close publishes the buffered events and stops the background goroutine. It
+// is safe to call more than once. Decisions made after Close are dropped.
+func (dp *DecisionPublisher) Close() {
+	dp.once.Do(func() {
+		dp.mu.Lock()
+		dp.closed = true
+		dp.mu.Unlock()
+
+		close(dp.stop)
+		<-dp.done
+		dp.ticker.Stop()
+	})
+}
+
+// The config without its salt, so it can be logged
+func (conf PublisherConfig) withoutSalt() PublisherConfig {
+	conf.Salt = nil
+	return conf
+}
+
+// Batch events and publish them when a batch is full, when the flush interval
+// passes and on Close
+func (dp *DecisionPublisher) run() {
+	defer close(dp.done)
+
+	batch := make([][]byte, 0, dp.conf.BatchSize)
+	add := func(event *DecisionEvent) {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			logger.Error("failed to encode decision event", "error", err)
+			dp.failed.Add(1)
+			return
+		}
+		batch = append(batch, payload)
+		if len(batch) >= dp.conf.BatchSize {
+			batch = dp.publish(batch)
+		}
+	}
+
+	for {
+		select {
+		case event := <-dp.events:
+			add(event)
+		case <-dp.ticker.C():
+			batch = dp.publish(batch)
+		case <-dp.stop:
+			for {
+				select {
+				case event := <-dp.events:
+					add(event)
+				default:
+					dp.publish(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Publish a batch, retrying as configured, and return it emptied for reuse
+func (dp *DecisionPublisher) publish(batch [][]byte) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	var err error
+	for range dp.conf.Retries + 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), dp.conf.PublishTimeout)
+		err = dp.sink.Publish(ctx, batch)
+		cancel()
+		if err == nil {
+			dp.published.Add(uint64(len(batch)))
+			return batch[:0]
+		}
+	}
+
+	logger.Error("failed to publish decision events", "events", len(batch), "error", err)
+	dp.failed.Add(uint64(len(batch)))
+	return batch[:0]
+}
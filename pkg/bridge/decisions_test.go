@@ -0,0 +1,210 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/tracker"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// A sink keeping the published events, failing the first failures calls
+type recordingSink struct {
+	mu       sync.Mutex
+	batches  [][]DecisionEvent
+	failures int
+	calls    int
+}
+
+func (s *recordingSink) Publish(_ context.Context, payloads [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("broker unavailable")
+	}
+	batch := make([]DecisionEvent, len(payloads))
+	for i, payload := range payloads {
+		if err := json.Unmarshal(payload, &batch[i]); err != nil {
+			return err
+		}
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *recordingSink) published() [][]DecisionEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+// A ticker fired by the test
+type manualTicker struct {
+	ch chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time   { return t.ch }
+func (t *manualTicker) Stop()                 {}
+func (t *manualTicker) Reset(_ time.Duration) {}
+
+var testSalt = []byte("salt")
+
+func newTestPublisher(sink Sink, conf PublisherConfig) (*DecisionPublisher, *manualTicker) {
+	conf.Salt = testSalt
+	ticker := &manualTicker{ch: make(chan time.Time)}
+	return newDecisionPublisher(sink, conf, utils.NewRealClock(), ticker), ticker
+}
+
+func TestDecisionPublisher(t *testing.T) {
+	sink := &recordingSink{}
+	publisher, err := NewDecisionPublisher(sink, PublisherConfig{Salt: testSalt, Namespace: "checkout", BatchSize: 2, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.4
+	conf.Observer = publisher
+	trk, err := tracker.NewFairnessTracker(conf)
+	require.NoError(t, err)
+	ctx := context.Background()
+	trk.ReportOutcome(ctx, []byte("bad"), request.OutcomeFailure)
+
+	for range 3 {
+		require.True(t, trk.RegisterRequest(ctx, []byte("bad")).ShouldThrottle)
+		require.False(t, trk.RegisterRequest(ctx, []byte("good")).ShouldThrottle)
+	}
+	trk.Close()
+	publisher.Close()
+
+	batches := sink.published()
+	require.Len(t, batches, 2, "a full batch and the rest on close")
+	require.Len(t, batches[0], 2)
+	require.Len(t, batches[1], 1)
+	event := batches[0][0]
+	assert.Equal(t, "checkout", event.Namespace)
+	assert.Equal(t, string(tracker.PrivateClientIdentifier(testSalt, []byte("bad"))), event.Client)
+	assert.Equal(t, 0.5, event.FinalProbability)
+	assert.False(t, event.Time.IsZero())
+	assert.Equal(t, PublisherStats{Published: 3}, publisher.Stats())
+}
+
+func TestDecisionPublisher_FlushInterval(t *testing.T) {
+	sink := &recordingSink{}
+	publisher, ticker := newTestPublisher(sink, PublisherConfig{BatchSize: 10, BufferSize: 10, PublishTimeout: time.Second})
+	defer publisher.Close()
+
+	publisher.OnThrottle([]byte("bad"), &request.RegisterRequestResult{FinalProbability: 1, ShadowThrottled: true})
+	require.Eventually(t, func() bool {
+		ticker.ch <- time.Now()
+		return len(sink.published()) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.True(t, sink.published()[0][0].Shadow)
+}
+
+func TestDecisionPublisher_Delivery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		retries  int
+		failures int
+		expected PublisherStats
+	}{
+		{name: "at most once", failures: 1, expected: PublisherStats{Failed: 1}},
+		{name: "retried", retries: 2, failures: 2, expected: PublisherStats{Published: 1}},
+		{name: "retries exhausted", retries: 1, failures: 2, expected: PublisherStats{Failed: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &recordingSink{failures: tc.failures}
+			publisher, _ := newTestPublisher(sink, PublisherConfig{BatchSize: 1, BufferSize: 10, Retries: tc.retries, PublishTimeout: time.Second})
+
+			publisher.OnThrottle([]byte("bad"), &request.RegisterRequestResult{FinalProbability: 1})
+			publisher.Close()
+
+			assert.Equal(t, tc.expected, publisher.Stats())
+			assert.Equal(t, min(tc.failures+1, tc.retries+1), sink.calls)
+		})
+	}
+}
+
+func TestDecisionPublisher_Dropped(t *testing.T) {
+	block := make(chan struct{})
+	sink := blockingSink{unblock: block}
+	publisher, _ := newTestPublisher(sink, PublisherConfig{BatchSize: 1, BufferSize: 1, PublishTimeout: time.Second})
+
+	// The first event blocks the goroutine in Publish, the second fills the
+	// buffer and the rest are dropped
+	for range 10 {
+		publisher.OnThrottle([]byte("bad"), &request.RegisterRequestResult{FinalProbability: 1})
+	}
+	close(block)
+	publisher.Close()
+	publisher.OnThrottle([]byte("bad"), &request.RegisterRequestResult{FinalProbability: 1})
+
+	stats := publisher.Stats()
+	assert.Equal(t, uint64(11), stats.Published+stats.Dropped)
+	assert.GreaterOrEqual(t, stats.Dropped, uint64(8))
+}
+
+// A sink blocking until it is unblocked
+type blockingSink struct {
+	unblock chan struct{}
+}
+
+func (s blockingSink) Publish(_ context.Context, _ [][]byte) error {
+	<-s.unblock
+	return nil
+}
+
+func TestNewDecisionPublisher_Invalid(t *testing.T) {
+	confs := []PublisherConfig{
+		{},
+		{Salt: testSalt, BatchSize: -1},
+		{Salt: testSalt, FlushInterval: -time.Second},
+		{Salt: testSalt, BufferSize: -1},
+		{Salt: testSalt, Retries: -1},
+		{Salt: testSalt, PublishTimeout: -time.Second},
+	}
+	for _, conf := range confs {
+		publisher, err := NewDecisionPublisher(&recordingSink{}, conf)
+
+		require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+		require.Nil(t, publisher)
+	}
+}
+
+func TestDecisionPublisher_Next(t *testing.T) {
+	next := &countingObserver{}
+	publisher, _ := newTestPublisher(&recordingSink{}, PublisherConfig{BatchSize: 1, BufferSize: 1, PublishTimeout: time.Second, Next: next})
+	defer publisher.Close()
+
+	publisher.OnThrottle([]byte("bad"), &request.RegisterRequestResult{})
+	publisher.OnRotation(1, 3)
+
+	assert.Equal(t, 1, next.throttles)
+	assert.Equal(t, 1, next.rotations)
+}
+
+type countingObserver struct {
+	throttles int
+	rotations int
+}
+
+func (o *countingObserver) OnThrottle(_ []byte, _ *request.RegisterRequestResult) { o.throttles++ }
+func (o *countingObserver) OnRotation(_, _ uint64)                                { o.rotations++ }
@@ -0,0 +1,166 @@
+// Package bridge connects trackers to message buses, so asynchronous pipelines
+// can report outcomes and downstream systems can follow throttling decisions
+// without calling the tracker synchronously. It is independent of any client
+// library: adapters for Kafka, NATS or other buses implement Source and Sink
+// in a few lines, and pick the topics or subjects to use.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/satmihir/fair/pkg/logger"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// The names used for outcomes in messages
+var outcomeNames = map[string]request.Outcome{
+	"success":      request.OutcomeSuccess,
+	"failure":      request.OutcomeFailure,
+	"timeout":      request.OutcomeTimeout,
+	"rejected":     request.OutcomeRejected,
+	"client_error": request.OutcomeClientError,
+}
+
+// The JSON representation of an OutcomeEvent
+type jsonOutcomeEvent struct {
+	Client  string  `json:"client"`
+	Outcome string  `json:"outcome"`
+	Cost    float64 `json:"cost"`
+}
+
+// DecodeJSON parses outcome events encoded as JSON objects such as
+// {"client": "customer-x", "outcome": "failure", "cost": 2}. The outcome is
+// one of "success", "failure", "timeout", "rejected" and "client_error", and
+// the cost is optional.
+func DecodeJSON(payload []byte) (*OutcomeEvent, error) {
+	var event jsonOutcomeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, NewBridgeError(err, "malformed JSON outcome event")
+	}
+	return newOutcomeEvent([]byte(event.Client), event.Outcome, event.Cost)
+}
+
+// DecodeProto parses outcome events encoded as protocol buffers with the
+// following schema. Unknown fields are ignored.
+//
+//	message OutcomeEvent {
+//	  bytes client = 1;
+//	  string outcome = 2; // as in DecodeJSON
+//	  double cost = 3;
+//	}
+func DecodeProto(payload []byte) (*OutcomeEvent, error) {
+	var client []byte
+	var outcome string
+	var cost float64
+	for len(payload) > 0 {
+		number, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return nil, NewBridgeError(protowire.ParseError(n), "malformed protobuf outcome event")
+		}
+		payload = payload[n:]
+
+		switch {
+		case number == 1 && wireType == protowire.BytesType:
+			client, n = protowire.ConsumeBytes(payload)
+		case number == 2 && wireType == protowire.BytesType:
+			var value []byte
+			value, n = protowire.ConsumeBytes(payload)
+			outcome = string(value)
+		case number == 3 && wireType == protowire.Fixed64Type:
+			var value uint64
+			value, n = protowire.ConsumeFixed64(payload)
+			cost = math.Float64frombits(value)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, payload)
+		}
+		if n < 0 {
+			return nil, NewBridgeError(protowire.ParseError(n), "malformed protobuf outcome event")
+		}
+		payload = payload[n:]
+	}
+	return newOutcomeEvent(client, outcome, cost)
+}
+
+// Validate the fields of a decoded event
+func newOutcomeEvent(client []byte, outcomeName string, cost float64) (*OutcomeEvent, error) {
+	if len(client) == 0 {
+		return nil, NewBridgeError(nil, "outcome event has no client")
+	}
+	outcome, ok := outcomeNames[outcomeName]
+	if !ok {
+		return nil, NewBridgeError(nil, "unknown outcome in outcome event: %q", outcomeName)
+	}
+	if cost == 0 {
+		cost = 1
+	}
+	if !(cost > 0) || math.IsInf(cost, 0) {
+		return nil, NewBridgeError(nil, "the cost of an outcome event must be finite and positive, found: %f", cost)
+	}
+	return &OutcomeEvent{ClientIdentifier: client, Outcome: outcome, Cost: cost}, nil
+}
+
+// OutcomeConsumer feeds outcome events consumed from a message bus into a
+// tracker.
+type OutcomeConsumer struct {
+	reporter OutcomeReporter
+	source   Source
+	decode   Decoder
+
+	reported atomic.Uint64
+	invalid  atomic.Uint64
+}
+
+// NewOutcomeConsumer creates a consumer reporting the events read from the
+// source and parsed with the decoder, such as DecodeJSON, to the reporter.
+func NewOutcomeConsumer(reporter OutcomeReporter, source Source, decode Decoder) *OutcomeConsumer {
+	return &OutcomeConsumer{
+		reporter: reporter,
+		source:   source,
+		decode:   decode,
+	}
+}
+
+// Run consumes events until the context is done, the source ends or the
+// reporter fails, for example because the tracker was closed. Messages that
+// can't be decoded are logged and skipped so a single bad message doesn't stop
+// the pipeline. It returns nil when the source ends with io.EOF.
+func (oc *OutcomeConsumer) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		payload, err := oc.source.Next(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		event, err := oc.decode(payload)
+		if err != nil {
+			oc.invalid.Add(1)
+			logger.Warn("skipped invalid outcome event", "error", err)
+			continue
+		}
+		if resp := oc.reporter.ReportOutcomeWithCost(ctx, event.ClientIdentifier, event.Outcome, event.Cost); resp.Err != nil {
+			return resp.Err
+		}
+		oc.reported.Add(1)
+	}
+}
+
+// Stats returns the number of messages processed so far.
+func (oc *OutcomeConsumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Reported: oc.reported.Load(),
+		Invalid:  oc.invalid.Load(),
+	}
+}
@@ -0,0 +1,149 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/tracker"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// A source replaying a fixed list of messages
+type sliceSource struct {
+	messages [][]byte
+}
+
+func (s *sliceSource) Next(_ context.Context) ([]byte, error) {
+	if len(s.messages) == 0 {
+		return nil, io.EOF
+	}
+	next := s.messages[0]
+	s.messages = s.messages[1:]
+	return next, nil
+}
+
+// Encode an outcome event with the schema of DecodeProto
+func protoOutcomeEvent(client, outcome string, cost float64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, client)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, outcome)
+	// An unknown field is skipped
+	b = protowire.AppendTag(b, 9, protowire.VarintType)
+	b = protowire.AppendVarint(b, 7)
+	if cost != 0 {
+		b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(cost))
+	}
+	return b
+}
+
+func TestDecoders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		decode   Decoder
+		payload  []byte
+		expected *OutcomeEvent
+	}{
+		{
+			name:     "JSON",
+			decode:   DecodeJSON,
+			payload:  []byte(`{"client": "customer-x", "outcome": "timeout", "cost": 2}`),
+			expected: &OutcomeEvent{ClientIdentifier: []byte("customer-x"), Outcome: request.OutcomeTimeout, Cost: 2},
+		},
+		{
+			name:     "JSON without cost",
+			decode:   DecodeJSON,
+			payload:  []byte(`{"client": "customer-x", "outcome": "success"}`),
+			expected: &OutcomeEvent{ClientIdentifier: []byte("customer-x"), Outcome: request.OutcomeSuccess, Cost: 1},
+		},
+		{name: "JSON malformed", decode: DecodeJSON, payload: []byte(`{"client"`)},
+		{name: "JSON no client", decode: DecodeJSON, payload: []byte(`{"outcome": "failure"}`)},
+		{name: "JSON unknown outcome", decode: DecodeJSON, payload: []byte(`{"client": "c", "outcome": "meh"}`)},
+		{name: "JSON negative cost", decode: DecodeJSON, payload: []byte(`{"client": "c", "outcome": "failure", "cost": -1}`)},
+		{
+			name:     "proto",
+			decode:   DecodeProto,
+			payload:  protoOutcomeEvent("customer-x", "client_error", 0.5),
+			expected: &OutcomeEvent{ClientIdentifier: []byte("customer-x"), Outcome: request.OutcomeClientError, Cost: 0.5},
+		},
+		{name: "proto truncated", decode: DecodeProto, payload: protoOutcomeEvent("customer-x", "failure", 0)[:5]},
+		{name: "proto infinite cost", decode: DecodeProto, payload: protoOutcomeEvent("customer-x", "failure", math.Inf(1))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			event, err := tc.decode(tc.payload)
+
+			if tc.expected == nil {
+				var bridgeErr *BridgeError
+				require.ErrorAs(t, err, &bridgeErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, event)
+		})
+	}
+}
+
+func TestOutcomeConsumer(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	trk, err := tracker.NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), utils.NewRealTicker(conf.RotationFrequency))
+	require.NoError(t, err)
+	defer trk.Close()
+	source := &sliceSource{messages: [][]byte{
+		[]byte(`{"client": "bad", "outcome": "failure"}`),
+		[]byte(`not json`),
+		[]byte(`{"client": "good", "outcome": "success"}`),
+	}}
+	consumer := NewOutcomeConsumer(trk, source, DecodeJSON)
+
+	require.NoError(t, consumer.Run(context.Background()))
+
+	assert.Equal(t, ConsumerStats{Reported: 2, Invalid: 1}, consumer.Stats())
+	ctx := context.Background()
+	assert.Equal(t, 0.5, trk.RegisterRequest(ctx, []byte("bad")).FinalProbability)
+	assert.Zero(t, trk.RegisterRequest(ctx, []byte("good")).FinalProbability)
+}
+
+func TestOutcomeConsumer_Stops(t *testing.T) {
+	trk, err := tracker.NewFairnessTracker(config.DefaultFairnessTrackerConfig())
+	require.NoError(t, err)
+	trk.Close()
+	message := []byte(`{"client": "bad", "outcome": "failure"}`)
+
+	err = NewOutcomeConsumer(trk, &sliceSource{messages: [][]byte{message}}, DecodeJSON).Run(context.Background())
+	require.ErrorIs(t, err, fairerrors.ErrClosed, "a closed tracker stops the consumer")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewOutcomeConsumer(trk, &sliceSource{messages: [][]byte{message}}, DecodeJSON).Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	sourceErr := errors.New("connection lost")
+	err = NewOutcomeConsumer(trk, failingSource{err: sourceErr}, DecodeJSON).Run(context.Background())
+	require.ErrorIs(t, err, sourceErr)
+}
+
+// A source whose subscription failed
+type failingSource struct {
+	err error
+}
+
+func (s failingSource) Next(_ context.Context) ([]byte, error) {
+	return nil, s.err
+}
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// Source delivers the payloads of messages from a topic or subject of a
+// message bus. Adapters for Kafka, NATS or any other client implement it by
+// returning one message per call. Next blocks until a message arrives and
+// returns io.EOF once the subscription is over.
+type Source interface {
+	Next(ctx context.Context) ([]byte, error)
+}
+
+// OutcomeReporter receives the outcomes consumed from a Source. FairnessTracker
+// implements it.
+type OutcomeReporter interface {
+	ReportOutcomeWithCost(ctx context.Context, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult
+}
+
+// OutcomeEvent is the outcome of a request as carried in a message.
+type OutcomeEvent struct {
+	// The client the request belongs to
+	ClientIdentifier []byte
+	// The outcome of the request
+	Outcome request.Outcome
+	// The cost of the request. Zero is treated as 1.
+	Cost float64
+}
+
+// Decoder parses the payload of a message into an OutcomeEvent.
+type Decoder func(payload []byte) (*OutcomeEvent, error)
+
+// ConsumerStats counts the messages an OutcomeConsumer has processed.
+type ConsumerStats struct {
+	// Number of outcomes reported to the tracker
+	Reported uint64
+	// Number of messages skipped because they couldn't be decoded
+	Invalid uint64
+}
+
+// BridgeError is returned when a message cannot be decoded or delivered.
+type BridgeError struct {
+	*utils.BaseError
+}
+
+// NewBridgeError wraps the given error with additional context for bridge
+// issues.
+func NewBridgeError(wrapped error, msg string, args ...any) *BridgeError {
+	return &BridgeError{
+		BaseError: utils.NewBaseError(wrapped, msg, args...),
+	}
+}
@@ -0,0 +1,137 @@
+// Package aggregators provides built-in functions that reduce the per-level
+// bucket probabilities of a client into the final throttling probability.
+// Every aggregator can be assigned to FairnessTrackerConfig.FinalProbabilityFunction
+// directly or looked up by name with ByName.
+package aggregators
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/satmihir/fair/pkg/logger"
+)
+
+const (
+	// NameMin selects Min.
+	NameMin = "min"
+	// NameMax selects Max.
+	NameMax = "max"
+	// NameMean selects Mean.
+	NameMean = "mean"
+	// NameGeometricMean selects GeometricMean.
+	NameGeometricMean = "geometric-mean"
+	// NameBottomKPrefix selects BottomK when followed by k, e.g. "bottom-2".
+	NameBottomKPrefix = "bottom-"
+)
+
+// Min returns the smallest probability. It is the most lenient aggregator: a
+// client is only throttled as much as its least congested bucket allows, which
+// keeps the false positive rate low.
+func Min(buckets []float64) float64 {
+	requireNonEmpty(buckets)
+
+	var minVal float64 = 1.
+	for _, b := range buckets {
+		minVal = math.Min(minVal, b)
+	}
+
+	return minVal
+}
+
+// Max returns the largest probability. It is the strictest aggregator and
+// throttles a client as soon as any of its buckets is congested.
+func Max(buckets []float64) float64 {
+	requireNonEmpty(buckets)
+
+	var maxVal float64
+	for _, b := range buckets {
+		maxVal = math.Max(maxVal, b)
+	}
+
+	return maxVal
+}
+
+// Mean returns the arithmetic mean of all probabilities and can be used in
+// scenarios where Min is too lenient.
+func Mean(buckets []float64) float64 {
+	requireNonEmpty(buckets)
+
+	var total float64
+	for _, b := range buckets {
+		total += b
+	}
+
+	return total / float64(len(buckets))
+}
+
+// GeometricMean returns the geometric mean of all probabilities. A single
+// bucket at zero pulls the result to zero, so it sits between Min and Mean.
+func GeometricMean(buckets []float64) float64 {
+	requireNonEmpty(buckets)
+
+	var logTotal float64
+	for _, b := range buckets {
+		logTotal += math.Log(b)
+	}
+
+	return math.Exp(logTotal / float64(len(buckets)))
+}
+
+// BottomK returns an aggregator that averages the k smallest probabilities.
+// BottomK(1) is equivalent to Min and a k at least as large as the number of
+// levels is equivalent to Mean. Values of k below 1 are treated as 1.
+func BottomK(k int) func([]float64) float64 {
+	if k < 1 {
+		k = 1
+	}
+
+	return func(buckets []float64) float64 {
+		requireNonEmpty(buckets)
+
+		sorted := make([]float64, len(buckets))
+		copy(sorted, buckets)
+		sort.Float64s(sorted)
+
+		n := k
+		if n > len(sorted) {
+			n = len(sorted)
+		}
+
+		return Mean(sorted[:n])
+	}
+}
+
+// ByName returns the aggregator registered under the given name. Supported
+// names are "min", "max", "mean", "geometric-mean" and "bottom-<k>" for a
+// positive integer k.
+func ByName(name string) (func([]float64) float64, error) {
+	switch name {
+	case NameMin:
+		return Min, nil
+	case NameMax:
+		return Max, nil
+	case NameMean:
+		return Mean, nil
+	case NameGeometricMean:
+		return GeometricMean, nil
+	}
+
+	if strings.HasPrefix(name, NameBottomKPrefix) {
+		k, err := strconv.Atoi(strings.TrimPrefix(name, NameBottomKPrefix))
+		if err != nil || k < 1 {
+			return nil, fmt.Errorf("invalid k in aggregator name %q", name)
+		}
+		return BottomK(k), nil
+	}
+
+	return nil, fmt.Errorf("unknown aggregator: %q", name)
+}
+
+func requireNonEmpty(buckets []float64) {
+	if len(buckets) == 0 {
+		logger.Fatalf("Cannot compute final probability with empty buckets slice")
+	}
+}
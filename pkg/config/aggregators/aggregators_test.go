@@ -0,0 +1,137 @@
+package aggregators
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/logger"
+)
+
+type panicLogger struct{}
+
+func (p *panicLogger) Printf(_ string, _ ...any) {}
+func (p *panicLogger) Print(_ ...any)            {}
+func (p *panicLogger) Println(_ ...any)          {}
+func (p *panicLogger) Fatalf(format string, args ...any) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func TestAggregators(t *testing.T) {
+	buckets := []float64{0.9, 0.4, 0.1, 0.4}
+
+	testCases := []struct {
+		name     string
+		fn       func([]float64) float64
+		expected float64
+	}{
+		{name: "min", fn: Min, expected: 0.1},
+		{name: "max", fn: Max, expected: 0.9},
+		{name: "mean", fn: Mean, expected: 0.45},
+		{name: "geometric mean", fn: GeometricMean, expected: math.Pow(0.9*0.4*0.1*0.4, 0.25)},
+		{name: "bottom-1 is min", fn: BottomK(1), expected: 0.1},
+		{name: "bottom-2", fn: BottomK(2), expected: 0.25},
+		{name: "bottom-k larger than levels is mean", fn: BottomK(10), expected: 0.45},
+		{name: "bottom-k below 1 is min", fn: BottomK(0), expected: 0.1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.fn(buckets)
+
+			require.InDelta(t, tc.expected, got, 1e-9)
+		})
+	}
+}
+
+func TestBottomK_DoesNotMutateInput(t *testing.T) {
+	buckets := []float64{0.9, 0.4, 0.1}
+
+	BottomK(2)(buckets)
+
+	require.Equal(t, []float64{0.9, 0.4, 0.1}, buckets)
+}
+
+func TestGeometricMean_ZeroBucket(t *testing.T) {
+	got := GeometricMean([]float64{0.9, 0, 0.5})
+
+	require.Equal(t, 0.0, got)
+}
+
+func TestAggregators_EmptySliceTriggersFatalLogger(t *testing.T) {
+	prevLogger := logger.GetLogger()
+	logger.SetLogger(&panicLogger{})
+	t.Cleanup(func() {
+		logger.SetLogger(prevLogger)
+	})
+
+	for name, fn := range map[string]func([]float64) float64{
+		NameMin:           Min,
+		NameMax:           Max,
+		NameMean:          Mean,
+		NameGeometricMean: GeometricMean,
+		"bottom-2":        BottomK(2),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Panics(t, func() {
+				fn([]float64{})
+			})
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	buckets := []float64{0.2, 0.6, 0.4}
+
+	testCases := []struct {
+		name     string
+		expected float64
+	}{
+		{name: "min", expected: 0.2},
+		{name: "max", expected: 0.6},
+		{name: "mean", expected: 0.4},
+		{name: "geometric-mean", expected: math.Cbrt(0.2 * 0.6 * 0.4)},
+		{name: "bottom-2", expected: 0.3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fn, err := ByName(tc.name)
+
+			require.NoError(t, err)
+			require.InDelta(t, tc.expected, fn(buckets), 1e-9)
+		})
+	}
+}
+
+func TestByName_Invalid(t *testing.T) {
+	for _, name := range []string{"", "median", "bottom-", "bottom-0", "bottom--1", "bottom-x"} {
+		t.Run(name, func(t *testing.T) {
+			fn, err := ByName(name)
+
+			require.Error(t, err)
+			require.Nil(t, fn)
+		})
+	}
+}
+
+func BenchmarkAggregators(b *testing.B) {
+	buckets := []float64{0.91, 0.12, 0.53, 0.04, 0.35, 0.76, 0.27, 0.68}
+
+	for name, fn := range map[string]func([]float64) float64{
+		NameMin:           Min,
+		NameMax:           Max,
+		NameMean:          Mean,
+		NameGeometricMean: GeometricMean,
+		"bottom-3":        BottomK(3),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fn(buckets)
+			}
+		})
+	}
+}
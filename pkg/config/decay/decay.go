@@ -0,0 +1,88 @@
+// Package decay provides built-in functions that decay the probability of a
+// bucket over the time since its last outcome, so throttled clients are
+// eventually forgiven. Every function can be assigned to
+// FairnessTrackerConfig.DecayFunction directly or looked up by name with
+// ByName.
+//
+// A function receives the probability, the Lambda of the config and the time
+// since the last update. What Lambda means depends on the function.
+package decay
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// NameExponential selects Exponential.
+	NameExponential = "exponential"
+	// NameLinear selects Linear.
+	NameLinear = "linear"
+	// NameNone selects None.
+	NameNone = "none"
+	// NameWindowPrefix selects Window when followed by a duration, e.g.
+	// "window-30s".
+	NameWindowPrefix = "window-"
+)
+
+// Exponential decays the probability by a factor of e^(-lambda * seconds). It
+// is the default and forgets a fixed fraction of the probability per second,
+// so heavily throttled clients are forgiven as quickly as lightly throttled
+// ones in relative terms.
+func Exponential(probability float64, lambda float64, elapsed time.Duration) float64 {
+	decayed := probability * math.Exp(-lambda*elapsed.Seconds())
+	if decayed < 0 {
+		return 0
+	}
+	return decayed
+}
+
+// Linear subtracts lambda from the probability per second, down to 0. A fully
+// throttled client is forgiven after 1/lambda seconds.
+func Linear(probability float64, lambda float64, elapsed time.Duration) float64 {
+	return max(probability-lambda*elapsed.Seconds(), 0)
+}
+
+// None never decays the probability. Clients are only forgiven by reporting
+// successes or by rotation.
+func None(probability float64, _ float64, _ time.Duration) float64 {
+	return probability
+}
+
+// Window returns a function that keeps the probability unchanged until the
+// bucket has gone the given window without outcomes and then drops it to 0.
+// Lambda is ignored.
+func Window(window time.Duration) func(float64, float64, time.Duration) float64 {
+	return func(probability float64, _ float64, elapsed time.Duration) float64 {
+		if elapsed >= window {
+			return 0
+		}
+		return probability
+	}
+}
+
+// ByName returns the decay function registered under the given name. Supported
+// names are "exponential", "linear", "none" and "window-<duration>" for a
+// positive duration such as "window-30s".
+func ByName(name string) (func(float64, float64, time.Duration) float64, error) {
+	switch name {
+	case NameExponential:
+		return Exponential, nil
+	case NameLinear:
+		return Linear, nil
+	case NameNone:
+		return None, nil
+	}
+
+	if strings.HasPrefix(name, NameWindowPrefix) {
+		window, err := time.ParseDuration(strings.TrimPrefix(name, NameWindowPrefix))
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window in decay function name %q", name)
+		}
+		return Window(window), nil
+	}
+
+	return nil, fmt.Errorf("unknown decay function: %q", name)
+}
@@ -0,0 +1,67 @@
+package decay
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecayFunctions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fn       func(float64, float64, time.Duration) float64
+		elapsed  time.Duration
+		expected float64
+	}{
+		{name: "exponential", fn: Exponential, elapsed: 2 * time.Second, expected: 0.8 * math.Exp(-0.2)},
+		{name: "exponential without elapsed time", fn: Exponential, expected: 0.8},
+		{name: "linear", fn: Linear, elapsed: 2 * time.Second, expected: 0.6},
+		{name: "linear floors at 0", fn: Linear, elapsed: time.Minute, expected: 0},
+		{name: "none", fn: None, elapsed: time.Hour, expected: 0.8},
+		{name: "window before expiry", fn: Window(time.Minute), elapsed: 59 * time.Second, expected: 0.8},
+		{name: "window at expiry", fn: Window(time.Minute), elapsed: time.Minute, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.fn(0.8, 0.1, tc.elapsed)
+
+			require.InDelta(t, tc.expected, got, 1e-9)
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected float64
+	}{
+		{name: "exponential", expected: 0.8 * math.Exp(-1)},
+		{name: "linear", expected: 0},
+		{name: "none", expected: 0.8},
+		{name: "window-5s", expected: 0},
+		{name: "window-1m", expected: 0.8},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fn, err := ByName(tc.name)
+
+			require.NoError(t, err)
+			require.InDelta(t, tc.expected, fn(0.8, 0.1, 10*time.Second), 1e-9)
+		})
+	}
+}
+
+func TestByName_Invalid(t *testing.T) {
+	for _, name := range []string{"", "step", "window-", "window-0s", "window--1s", "window-x"} {
+		t.Run(name, func(t *testing.T) {
+			fn, err := ByName(name)
+
+			require.Error(t, err)
+			require.Nil(t, fn)
+		})
+	}
+}
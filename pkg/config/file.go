@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/satmihir/fair/pkg/config/aggregators"
+	"github.com/satmihir/fair/pkg/config/decay"
+	"github.com/satmihir/fair/pkg/config/hashers"
+	"github.com/satmihir/fair/pkg/logger"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// A reference to an environment variable in a config file
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// The names used for failure-like outcomes in config files
+var outcomeNames = map[string]request.Outcome{
+	"failure":      request.OutcomeFailure,
+	"timeout":      request.OutcomeTimeout,
+	"rejected":     request.OutcomeRejected,
+	"client_error": request.OutcomeClientError,
+}
+
+// The names used for priorities in config files
+var priorityNames = map[string]request.Priority{
+	"high":   request.PriorityHigh,
+	"normal": request.PriorityNormal,
+	"low":    request.PriorityLow,
+}
+
+// FileConfig is the file representation of FairnessTrackerConfig. Functions
+// are referenced by name and durations are written as strings such as "5m".
+// Fields missing from the file keep the values of DefaultFairnessTrackerConfig.
+// LogLevel, such as "debug" or "warn", isn't part of the tracker config: it
+// sets the minimum level of the structured events of the logger package for
+// the whole process, and an empty value keeps the current level.
+type FileConfig struct {
+	M                           uint32             `yaml:"m"`
+	L                           uint32             `yaml:"l"`
+	Pi                          float64            `yaml:"pi"`
+	Pd                          float64            `yaml:"pd"`
+	Lambda                      float64            `yaml:"lambda"`
+	RotationFrequency           time.Duration      `yaml:"rotation_frequency"`
+	NumGenerations              uint32             `yaml:"num_generations"`
+	IncludeStats                bool               `yaml:"include_stats"`
+	DecayFunction               string             `yaml:"decay_function"`
+	Aggregator                  string             `yaml:"aggregator"`
+	HashFunction                string             `yaml:"hash_function"`
+	HashSeed                    uint32             `yaml:"hash_seed"`
+	DecisionMode                DecisionMode       `yaml:"decision_mode"`
+	DecisionThreshold           float64            `yaml:"decision_threshold"`
+	MinPassRate                 float64            `yaml:"min_pass_rate"`
+	ThrottleMode                ThrottleMode       `yaml:"throttle_mode"`
+	MaxRetryAfter               time.Duration      `yaml:"max_retry_after"`
+	TopThrottledClientsCapacity uint32             `yaml:"top_throttled_clients_capacity"`
+	MaxRPS                      float64            `yaml:"max_rps"`
+	Burst                       uint32             `yaml:"burst"`
+	DecisionCacheSize           uint32             `yaml:"decision_cache_size"`
+	DecisionCacheTTL            time.Duration      `yaml:"decision_cache_ttl"`
+	PendingRequestTTL           time.Duration      `yaml:"pending_request_ttl"`
+	ResourceBlastRadius         uint32             `yaml:"resource_blast_radius"`
+	TenantWeight                float64            `yaml:"tenant_weight"`
+	UserWeight                  float64            `yaml:"user_weight"`
+	OutcomeMultipliers          map[string]float64 `yaml:"outcome_multipliers"`
+	PriorityMultipliers         map[string]float64 `yaml:"priority_multipliers"`
+	PrivacySalt                 string             `yaml:"privacy_salt"`
+	LatencyTarget               time.Duration      `yaml:"latency_target"`
+	LatencyLimit                time.Duration      `yaml:"latency_limit"`
+	LogLevel                    string             `yaml:"log_level"`
+}
+
+// LoadConfigFile reads a tracker config from a YAML or JSON file. See
+// ParseConfig for the format.
+func LoadConfigFile(path string) (*FairnessTrackerConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return ParseConfig(raw)
+}
+
+// ParseConfig parses a tracker config written in YAML or JSON using the field
+// names of FileConfig. References to environment variables written as ${VAR}
+// in values are replaced with their values, and referencing a variable that
+// isn't set is an error. Unknown fields are rejected to catch typos. The
+// values are not validated against the invariants of the algorithm; the
+// tracker does that when it is built. A log_level is applied to the logger
+// package once the whole config has been parsed.
+func ParseConfig(raw []byte) (*FairnessTrackerConfig, error) {
+	defaults := DefaultFairnessTrackerConfig()
+	fc := &FileConfig{
+		M:                 defaults.M,
+		L:                 defaults.L,
+		Pi:                defaults.Pi,
+		Pd:                defaults.Pd,
+		Lambda:            defaults.Lambda,
+		RotationFrequency: defaults.RotationFrequency,
+		DecayFunction:     decay.NameExponential,
+		Aggregator:        aggregators.NameMin,
+		HashFunction:      hashers.NameMurmur3,
+		ThrottleMode:      defaults.ThrottleMode,
+		MaxRetryAfter:     defaults.MaxRetryAfter,
+	}
+
+	// JSON is valid YAML, so a single decoder handles both formats
+	var document yaml.Node
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := expandEnv(&document); err != nil {
+		return nil, err
+	}
+	// Nodes can't be decoded strictly, so decode the expanded document again
+	expanded, err := yaml.Marshal(&document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(expanded))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var level slog.Level
+	if fc.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(fc.LogLevel)); err != nil {
+			return nil, fmt.Errorf("invalid log_level: %w", err)
+		}
+	}
+	conf, err := fc.TrackerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if fc.LogLevel != "" {
+		logger.SetLevel(level)
+	}
+	return conf, nil
+}
+
+// Replace the references to environment variables in the scalar values of the
+// document. Mapping keys are left as they are.
+func expandEnv(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var missing string
+		value := envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return value
+		})
+		if missing != "" {
+			return fmt.Errorf("the config references the environment variable %s, which is not set", missing)
+		}
+		if value != node.Value && node.Style == 0 {
+			// Resolve the type of plain values again, so ${VAR} can be a number
+			node.Tag = ""
+		}
+		node.Value = value
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandEnv(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, child := range node.Content {
+			if err := expandEnv(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TrackerConfig resolves the names in the file config and returns the
+// equivalent FairnessTrackerConfig.
+func (fc *FileConfig) TrackerConfig() (*FairnessTrackerConfig, error) {
+	aggregator, err := aggregators.ByName(fc.Aggregator)
+	if err != nil {
+		return nil, err
+	}
+	hashFunction, err := hashers.ByName(fc.HashFunction)
+	if err != nil {
+		return nil, err
+	}
+	decayFunction, err := decay.ByName(fc.DecayFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomeMultipliers map[request.Outcome]float64
+	if len(fc.OutcomeMultipliers) > 0 {
+		outcomeMultipliers = make(map[request.Outcome]float64, len(fc.OutcomeMultipliers))
+		for name, multiplier := range fc.OutcomeMultipliers {
+			outcome, ok := outcomeNames[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown outcome in outcome_multipliers: %q", name)
+			}
+			outcomeMultipliers[outcome] = multiplier
+		}
+	}
+
+	var priorityMultipliers map[request.Priority]float64
+	if len(fc.PriorityMultipliers) > 0 {
+		priorityMultipliers = make(map[request.Priority]float64, len(fc.PriorityMultipliers))
+		for name, multiplier := range fc.PriorityMultipliers {
+			priority, ok := priorityNames[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown priority in priority_multipliers: %q", name)
+			}
+			priorityMultipliers[priority] = multiplier
+		}
+	}
+
+	return &FairnessTrackerConfig{
+		M:                           fc.M,
+		L:                           fc.L,
+		Pi:                          fc.Pi,
+		Pd:                          fc.Pd,
+		Lambda:                      fc.Lambda,
+		DecayFunction:               decayFunction,
+		RotationFrequency:           fc.RotationFrequency,
+		NumGenerations:              fc.NumGenerations,
+		IncludeStats:                fc.IncludeStats,
+		FinalProbabilityFunction:    aggregator,
+		HashFunction:                hashFunction,
+		HashSeed:                    fc.HashSeed,
+		DecisionMode:                fc.DecisionMode,
+		DecisionThreshold:           fc.DecisionThreshold,
+		MinPassRate:                 fc.MinPassRate,
+		ThrottleMode:                fc.ThrottleMode,
+		MaxRetryAfter:               fc.MaxRetryAfter,
+		TopThrottledClientsCapacity: fc.TopThrottledClientsCapacity,
+		MaxRPS:                      fc.MaxRPS,
+		Burst:                       fc.Burst,
+		DecisionCacheSize:           fc.DecisionCacheSize,
+		DecisionCacheTTL:            fc.DecisionCacheTTL,
+		PendingRequestTTL:           fc.PendingRequestTTL,
+		ResourceBlastRadius:         fc.ResourceBlastRadius,
+		TenantWeight:                fc.TenantWeight,
+		UserWeight:                  fc.UserWeight,
+		OutcomeMultipliers:          outcomeMultipliers,
+		PriorityMultipliers:         priorityMultipliers,
+		PrivacySalt:                 []byte(fc.PrivacySalt),
+		LatencyTarget:               fc.LatencyTarget,
+		LatencyLimit:                fc.LatencyLimit,
+	}, nil
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/logger"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+func TestParseConfig_YAML(t *testing.T) {
+	raw := []byte(`
+m: 500
+l: 4
+pi: 0.2
+pd: 0.002
+lambda: 0.05
+decay_function: window-30s
+rotation_frequency: 2m
+num_generations: 3
+include_stats: true
+aggregator: mean
+hash_function: maphash
+hash_seed: 42
+decision_mode: threshold
+decision_threshold: 0.7
+min_pass_rate: 0.01
+throttle_mode: delay
+max_retry_after: 3s
+top_throttled_clients_capacity: 10
+max_rps: 100
+burst: 20
+decision_cache_size: 1000
+decision_cache_ttl: 10ms
+pending_request_ttl: 30s
+resource_blast_radius: 5
+tenant_weight: 1
+user_weight: 3
+outcome_multipliers:
+  timeout: 2
+  client_error: 0.5
+priority_multipliers:
+  high: 0.5
+  low: 2
+privacy_salt: salt
+latency_target: 100ms
+latency_limit: 1s
+`)
+
+	conf, err := ParseConfig(raw)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint32(500), conf.M)
+	assert.Equal(t, uint32(4), conf.L)
+	assert.Equal(t, 0.2, conf.Pi)
+	assert.Equal(t, 0.002, conf.Pd)
+	assert.Equal(t, 0.05, conf.Lambda)
+	assert.Equal(t, 0.0, conf.DecayFunction(0.5, 0.05, 30*time.Second), "should use a 30s window")
+	assert.Equal(t, 2*time.Minute, conf.RotationFrequency)
+	assert.Equal(t, uint32(3), conf.NumGenerations)
+	assert.True(t, conf.IncludeStats)
+	assert.Equal(t, 0.5, conf.FinalProbabilityFunction([]float64{0, 1}), "should use the mean aggregator")
+	assert.NotNil(t, conf.HashFunction)
+	assert.Equal(t, uint32(42), conf.HashSeed)
+	assert.Equal(t, DecisionModeThreshold, conf.DecisionMode)
+	assert.Equal(t, 0.7, conf.DecisionThreshold)
+	assert.Equal(t, 0.01, conf.MinPassRate)
+	assert.Equal(t, ThrottleModeDelay, conf.ThrottleMode)
+	assert.Equal(t, 3*time.Second, conf.MaxRetryAfter)
+	assert.Equal(t, uint32(10), conf.TopThrottledClientsCapacity)
+	assert.Equal(t, 100.0, conf.MaxRPS)
+	assert.Equal(t, uint32(20), conf.Burst)
+	assert.Equal(t, uint32(1000), conf.DecisionCacheSize)
+	assert.Equal(t, 10*time.Millisecond, conf.DecisionCacheTTL)
+	assert.Equal(t, 30*time.Second, conf.PendingRequestTTL)
+	assert.Equal(t, uint32(5), conf.ResourceBlastRadius)
+	assert.Equal(t, 1.0, conf.TenantWeight)
+	assert.Equal(t, 3.0, conf.UserWeight)
+	assert.Equal(t, map[request.Outcome]float64{request.OutcomeTimeout: 2, request.OutcomeClientError: 0.5}, conf.OutcomeMultipliers)
+	assert.Equal(t, map[request.Priority]float64{request.PriorityHigh: 0.5, request.PriorityLow: 2}, conf.PriorityMultipliers)
+	assert.Equal(t, []byte("salt"), conf.PrivacySalt)
+	assert.Equal(t, 100*time.Millisecond, conf.LatencyTarget)
+	assert.Equal(t, time.Second, conf.LatencyLimit)
+}
+
+func TestParseConfig_JSON(t *testing.T) {
+	conf, err := ParseConfig([]byte(`{"pi": 0.3, "rotation_frequency": "10m", "throttle_mode": "shadow"}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, 0.3, conf.Pi)
+	assert.Equal(t, 10*time.Minute, conf.RotationFrequency)
+	assert.Equal(t, ThrottleModeShadow, conf.ThrottleMode)
+}
+
+func TestParseConfig_Defaults(t *testing.T) {
+	defaults := DefaultFairnessTrackerConfig()
+
+	for _, raw := range []string{"", "pi: 0.1"} {
+		conf, err := ParseConfig([]byte(raw))
+
+		require.NoError(t, err)
+		assert.Equal(t, defaults.M, conf.M)
+		assert.Equal(t, defaults.L, conf.L)
+		assert.Equal(t, defaults.Pd, conf.Pd)
+		assert.Equal(t, defaults.Lambda, conf.Lambda)
+		assert.Equal(t, defaults.RotationFrequency, conf.RotationFrequency)
+		assert.Equal(t, defaults.ThrottleMode, conf.ThrottleMode)
+		assert.Equal(t, defaults.MaxRetryAfter, conf.MaxRetryAfter)
+		assert.Equal(t, 0.1, conf.FinalProbabilityFunction([]float64{0.1, 0.9}), "should use the min aggregator")
+		assert.NotNil(t, conf.HashFunction)
+		assert.InDelta(t, 0.5*math.Exp(-defaults.Lambda), conf.DecayFunction(0.5, defaults.Lambda, time.Second), 1e-9,
+			"should use exponential decay")
+	}
+}
+
+func TestParseConfig_EnvInterpolation(t *testing.T) {
+	t.Setenv("FAIR_THROTTLE_MODE", "shadow")
+	t.Setenv("FAIR_MAX_RPS", "250")
+	t.Setenv("FAIR_SALT", "s3cr$t")
+
+	conf, err := ParseConfig([]byte("throttle_mode: ${FAIR_THROTTLE_MODE}\nmax_rps: ${FAIR_MAX_RPS}\nprivacy_salt: ${FAIR_SALT}\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, ThrottleModeShadow, conf.ThrottleMode)
+	assert.Equal(t, 250.0, conf.MaxRPS)
+	assert.Equal(t, []byte("s3cr$t"), conf.PrivacySalt)
+}
+
+func TestParseConfig_LogLevel(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+
+	_, err := ParseConfig([]byte("log_level: debug\n"))
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, logger.GetLevel())
+
+	_, err = ParseConfig([]byte("pi: 0.1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, logger.GetLevel(), "an empty log_level keeps the level")
+
+	conf, err := ParseConfig([]byte("log_level: loud\n"))
+	require.Error(t, err)
+	require.Nil(t, conf)
+	assert.Equal(t, slog.LevelDebug, logger.GetLevel())
+}
+
+func TestParseConfig_EnvInterpolationLiteralDollars(t *testing.T) {
+	t.Setenv("HOME", "/home/fair")
+
+	conf, err := ParseConfig([]byte("privacy_salt: a$HOME$b\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a$HOME$b"), conf.PrivacySalt, "only ${VAR} references are replaced")
+}
+
+func TestParseConfig_EnvInterpolationUnset(t *testing.T) {
+	conf, err := ParseConfig([]byte("privacy_salt: ${FAIR_UNSET_VARIABLE}\n"))
+
+	require.ErrorContains(t, err, "FAIR_UNSET_VARIABLE")
+	require.Nil(t, conf)
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	testCases := map[string]string{
+		"unknown field":      "pie: 0.1",
+		"malformed":          "pi: [",
+		"wrong type":         "m: lots",
+		"bad duration":       "rotation_frequency: soon",
+		"unknown aggregator": "aggregator: median",
+		"unknown hash":       "hash_function: md5",
+		"unknown decay":      "decay_function: step",
+		"unknown outcome":    "outcome_multipliers: {success: 1}",
+		"unknown priority":   "priority_multipliers: {urgent: 1}",
+	}
+
+	for name, raw := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf, err := ParseConfig([]byte(raw))
+
+			require.Error(t, err)
+			assert.Nil(t, conf)
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fair.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pi: 0.4\n"), 0o600))
+
+	conf, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0.4, conf.Pi)
+
+	_, err = LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+// Malformed config files must be rejected with an error rather than a panic
+func FuzzParseConfig(f *testing.F) {
+	f.Add([]byte("m: 500\nl: 4\npi: 0.2\ndecay_function: window-30s\n"))
+	f.Add([]byte(`{"pi": 0.3, "rotation_frequency": "10m", "throttle_mode": "shadow"}`))
+	f.Add([]byte("pi: .nan\nlambda: .inf\nhash_seed: 4294967295\n"))
+	f.Add([]byte("outcome_multipliers:\n  timeout: -1\n"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		conf, err := ParseConfig(raw)
+		if err != nil {
+			require.Nil(t, conf)
+			return
+		}
+		require.NotNil(t, conf.FinalProbabilityFunction)
+		require.NotNil(t, conf.HashFunction)
+		require.NotNil(t, conf.DecayFunction)
+	})
+}
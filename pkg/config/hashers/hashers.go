@@ -0,0 +1,68 @@
+// Package hashers provides built-in hash functions that map a client
+// identifier to the buckets of the tracker's structure. Every hasher can be
+// assigned to FairnessTrackerConfig.HashFunction directly or looked up by name
+// with ByName.
+//
+// A hasher returns a 128-bit hash as two 64-bit halves. The structure derives
+// one bucket per level from the halves with double hashing
+// (https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf), so a
+// single hash computation covers any number of levels.
+package hashers
+
+import (
+	"fmt"
+	"hash/maphash"
+
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// NameMurmur3 selects Murmur3.
+	NameMurmur3 = "murmur3"
+	// NameMaphash selects Maphash.
+	NameMaphash = "maphash"
+)
+
+// The process-wide maphash seed. Mixing in the structure seed on top of it
+// keeps hashes different across structures.
+var maphashSeed = maphash.MakeSeed()
+
+// Murmur3 hashes the input with the 128-bit variant of MurmurHash3. It is the
+// default and is stable across processes and platforms.
+func Murmur3(input []byte, seed uint32) (uint64, uint64) {
+	return murmur3.Sum128WithSeed(input, seed)
+}
+
+// Maphash hashes the input with the runtime's hash/maphash, which uses AES
+// hardware instructions where available and is typically the fastest option.
+// Its output is only stable within a single process, so it must not be used
+// when hashes are compared across instances.
+func Maphash(input []byte, seed uint32) (uint64, uint64) {
+	h1 := mix64(maphash.Bytes(maphashSeed, input) ^ uint64(seed))
+	h2 := mix64(h1)
+	return h1, h2
+}
+
+// ByName returns the hasher registered under the given name. Supported names
+// are "murmur3" and "maphash".
+func ByName(name string) (func([]byte, uint32) (uint64, uint64), error) {
+	switch name {
+	case NameMurmur3:
+		return Murmur3, nil
+	case NameMaphash:
+		return Maphash, nil
+	default:
+		return nil, fmt.Errorf("unknown hash function: %q", name)
+	}
+}
+
+// The splitmix64 finalizer, used to derive well-distributed 64-bit values from
+// a single hash
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
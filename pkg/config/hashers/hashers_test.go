@@ -0,0 +1,76 @@
+package hashers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashers_DeterministicForSameSeed(t *testing.T) {
+	for name, fn := range map[string]func([]byte, uint32) (uint64, uint64){
+		NameMurmur3: Murmur3,
+		NameMaphash: Maphash,
+	} {
+		t.Run(name, func(t *testing.T) {
+			a1, a2 := fn([]byte("client"), 7)
+			b1, b2 := fn([]byte("client"), 7)
+
+			require.Equal(t, a1, b1)
+			require.Equal(t, a2, b2)
+		})
+	}
+}
+
+func TestHashers_SeedChangesHash(t *testing.T) {
+	for name, fn := range map[string]func([]byte, uint32) (uint64, uint64){
+		NameMurmur3: Murmur3,
+		NameMaphash: Maphash,
+	} {
+		t.Run(name, func(t *testing.T) {
+			a1, a2 := fn([]byte("client"), 1)
+			b1, b2 := fn([]byte("client"), 2)
+
+			require.False(t, a1 == b1 && a2 == b2)
+		})
+	}
+}
+
+func TestMurmur3_StableAcrossProcesses(t *testing.T) {
+	h1, h2 := Murmur3([]byte("hello world"), 5)
+
+	require.Equal(t, uint64(0x6e137e259a04790f), h1)
+	require.Equal(t, uint64(0x0f7a98313a850777), h2)
+}
+
+func TestByName(t *testing.T) {
+	fn, err := ByName("murmur3")
+	require.NoError(t, err)
+	e1, e2 := Murmur3([]byte("x"), 1)
+	g1, g2 := fn([]byte("x"), 1)
+	require.Equal(t, e1, g1)
+	require.Equal(t, e2, g2)
+
+	_, err = ByName("maphash")
+	require.NoError(t, err)
+
+	fn, err = ByName("crc32")
+	require.Error(t, err)
+	require.Nil(t, fn)
+}
+
+func BenchmarkHashers(b *testing.B) {
+	input := []byte("tenant-1234/client-5678")
+
+	for name, fn := range map[string]func([]byte, uint32) (uint64, uint64){
+		NameMurmur3: Murmur3,
+		NameMaphash: Maphash,
+	} {
+		b.Run(fmt.Sprintf("%s/%dB", name, len(input)), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fn(input, uint32(i))
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"math"
 	"time"
 
+	"github.com/satmihir/fair/pkg/config/aggregators"
+	"github.com/satmihir/fair/pkg/config/hashers"
 	"github.com/satmihir/fair/pkg/logger"
 )
 
@@ -28,45 +30,40 @@ const (
 	minL = 3
 	// The default rotation duration
 	defaultRotationDuration = time.Minute * 5
+	// The smallest number of buckets per level GenerateTunedConfig will choose
+	minBucketsPerLevel = 100
+	// The throttle probability at which a blocked flow is considered recovered
+	recoveredProbability = 0.01
+	// The default retry-after suggested for a fully throttled flow in delay mode
+	defaultMaxRetryAfter = time.Second * 10
 )
 
 // FinalProbabilityFunction chooses a final probability from a slice of bucket
 // probabilities.
 type FinalProbabilityFunction func([]float64) float64
 
+// HashFunction computes a 128-bit hash of a client identifier, returned as two
+// 64-bit halves. The bucket at every level is derived from the halves, so one
+// call covers all levels. See the hashers package for built-in implementations.
+type HashFunction func(input []byte, seed uint32) (uint64, uint64)
+
+// DecayFunction returns the probability a bucket decays to after the given
+// time without outcomes. Lambda is the decay rate from the config and its
+// meaning depends on the function. See the decay package for built-in
+// implementations.
+type DecayFunction func(probability float64, lambda float64, elapsed time.Duration) float64
+
 var (
 	generateTunedStructureConfig = GenerateTunedStructureConfig
 
 	// MinFinalProbabilityFunction returns the smallest probability in the
 	// slice. It is the default implementation used by the tracker.
-	MinFinalProbabilityFunction FinalProbabilityFunction = func(buckets []float64) float64 {
-		if len(buckets) == 0 {
-			logger.Fatalf("Cannot compute final probability with empty buckets slice")
-		}
-
-		var minVal float64 = 1.
-		for _, b := range buckets {
-			minVal = math.Min(minVal, b)
-		}
-
-		return minVal
-	}
+	MinFinalProbabilityFunction FinalProbabilityFunction = aggregators.Min
 
 	// MeanFinalProbabilityFunction returns the mean of all bucket
 	// probabilities and can be used in scenarios where the minimum value is
 	// too strict.
-	MeanFinalProbabilityFunction FinalProbabilityFunction = func(buckets []float64) float64 {
-		if len(buckets) == 0 {
-			logger.Fatalf("Cannot compute final probability with empty buckets slice")
-		}
-
-		var total float64
-		for _, b := range buckets {
-			total += b
-		}
-
-		return total / float64(len(buckets))
-	}
+	MeanFinalProbabilityFunction FinalProbabilityFunction = aggregators.Mean
 )
 
 // DefaultFairnessTrackerConfig returns a configuration that should work well
@@ -83,6 +80,21 @@ func DefaultFairnessTrackerConfig() *FairnessTrackerConfig {
 	return conf
 }
 
+// DefaultFairnessTrackerConfigWithAggregator returns the default configuration
+// with the final probability function chosen by name. This is useful where a
+// function cannot be passed directly, such as configuration read from the
+// environment. See aggregators.ByName for the supported names.
+func DefaultFairnessTrackerConfigWithAggregator(name string) (*FairnessTrackerConfig, error) {
+	fn, err := aggregators.ByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := DefaultFairnessTrackerConfig()
+	conf.FinalProbabilityFunction = fn
+	return conf, nil
+}
+
 // Generates a "good enough" config to use for a structure underneath the throttler
 // which requires minimal tuning and should be able to get decent results in most
 // cases. If more tuning is desired, the clients can directly provide their own
@@ -133,6 +145,77 @@ func GenerateTunedStructureConfig(expectedClientFlows, bucketsPerLevel, tolerabl
 		RotationFrequency:        defaultRotationDuration,
 		IncludeStats:             false,
 		FinalProbabilityFunction: MinFinalProbabilityFunction,
+		HashFunction:             hashers.Murmur3,
+		ThrottleMode:             ThrottleModeReject,
+		MaxRetryAfter:            defaultMaxRetryAfter,
+	}, nil
+}
+
+// GenerateTunedConfig derives a complete configuration from user-meaningful
+// inputs instead of algorithm parameters.
+//
+// Parameters:
+//   - expectedClients: number of concurrent clients you expect.
+//   - tolerableFalsePositiveRate: acceptable probability that a well-behaved
+//     client shares all of its buckets with misbehaving ones, in (0, 1).
+//   - recoveryTime: how long a fully blocked client that stops misbehaving
+//     takes to be admitted again.
+//
+// The math:
+//
+// We assume 0.1% of clients misbehave at a time, giving K bad flows. A
+// well-behaved flow is a false positive when every one of its L buckets is
+// shared with a bad flow. With B buckets per level that happens with
+// probability p = (1 - (1 - 1/B)^K)^L. For a fixed p, the memory B*L is
+// minimized when each level is half occupied, which is B = K/ln(2), just
+// like a Bloom filter. B is floored at 100 so small deployments still get a
+// reasonable spread, and L is then solved from p with CalculateL (at least 3).
+//
+// Probabilities decay as e^(-Lambda*t), so Lambda = ln(1/0.01)/recoveryTime
+// brings a fully blocked flow down to a 1% throttle probability within
+// recoveryTime. Structures rotate every recoveryTime so that an innocent flow
+// colliding with a bad one is rehashed on the same timescale.
+//
+// Pi and Pd follow the defaults: a flow is fully blocked after 25 bad
+// requests and recovers through successes 1000x more slowly.
+func GenerateTunedConfig(expectedClients uint64, tolerableFalsePositiveRate float64, recoveryTime time.Duration) (*FairnessTrackerConfig, error) {
+	if expectedClients == 0 {
+		return nil, fmt.Errorf("expectedClients must be greater than 0")
+	}
+	if !(tolerableFalsePositiveRate > 0 && tolerableFalsePositiveRate < 1) {
+		return nil, fmt.Errorf("tolerableFalsePositiveRate must be in (0, 1), found: %f", tolerableFalsePositiveRate)
+	}
+	if recoveryTime <= 0 {
+		return nil, fmt.Errorf("recoveryTime must be greater than 0, found: %v", recoveryTime)
+	}
+
+	K := math.Ceil(float64(expectedClients) * percentBadClientFlows)
+	B := math.Max(math.Ceil(K/math.Ln2), minBucketsPerLevel)
+	if B > math.MaxUint32 || K > math.MaxUint32 {
+		return nil, fmt.Errorf("expectedClients is too large: %d", expectedClients)
+	}
+
+	L := CalculateL(uint32(B), uint32(K), tolerableFalsePositiveRate)
+	if L < minL {
+		L = minL
+	}
+
+	Pi := 1 / float64(defaultTolerableBadRequestsPerBadFlow)
+	Pd := pdSlowingFactor * Pi
+	Lambda := math.Log(1/recoveredProbability) / recoveryTime.Seconds()
+
+	return &FairnessTrackerConfig{
+		M:                        uint32(B),
+		L:                        L,
+		Pi:                       Pi,
+		Pd:                       Pd,
+		Lambda:                   Lambda,
+		RotationFrequency:        recoveryTime,
+		IncludeStats:             false,
+		FinalProbabilityFunction: MinFinalProbabilityFunction,
+		HashFunction:             hashers.Murmur3,
+		ThrottleMode:             ThrottleModeReject,
+		MaxRetryAfter:            defaultMaxRetryAfter,
 	}, nil
 }
 
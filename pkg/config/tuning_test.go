@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/satmihir/fair/pkg/logger"
 	"github.com/stretchr/testify/assert"
@@ -31,6 +33,9 @@ func TestGenerateTunedStructureConfig(t *testing.T) {
 	assert.Equal(t, int(conf.M), 1000)
 	assert.Equal(t, conf.Pi*25, float64(1))
 	assert.Equal(t, conf.Pd*25*1000, float64(1))
+	assert.NotNil(t, conf.HashFunction)
+	assert.Equal(t, ThrottleModeReject, conf.ThrottleMode)
+	assert.Equal(t, defaultMaxRetryAfter, conf.MaxRetryAfter)
 }
 
 func TestDefaultStructureConfig(t *testing.T) {
@@ -41,6 +46,78 @@ func TestDefaultStructureConfig(t *testing.T) {
 	assert.Equal(t, conf.Pd*25*1000, float64(1))
 }
 
+func TestDefaultFairnessTrackerConfigWithAggregator(t *testing.T) {
+	conf, err := DefaultFairnessTrackerConfigWithAggregator("max")
+	require.NoError(t, err)
+	require.Equal(t, 0.7, conf.FinalProbabilityFunction([]float64{0.1, 0.7, 0.3}))
+	require.Equal(t, int(conf.L), 3)
+
+	conf, err = DefaultFairnessTrackerConfigWithAggregator("median")
+	require.Error(t, err)
+	require.Nil(t, conf)
+}
+
+func TestGenerateTunedConfig(t *testing.T) {
+	testCases := []struct {
+		name            string
+		expectedClients uint64
+		fpRate          float64
+		expectedM       uint32
+		expectedL       uint32
+	}{
+		// K = 1 bad flow, B floored at 100, L floored at 3
+		{name: "small deployment uses floors", expectedClients: 1000, fpRate: 0.01, expectedM: 100, expectedL: 3},
+		// K = 1000, B = ceil(1000/ln2) = 1443, per-level collision ~0.5 so L = ceil(log2(1e4)) = 14
+		{name: "large deployment half occupies levels", expectedClients: 1_000_000, fpRate: 0.0001, expectedM: 1443, expectedL: 14},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := GenerateTunedConfig(tc.expectedClients, tc.fpRate, time.Minute)
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedM, conf.M)
+			require.Equal(t, tc.expectedL, conf.L)
+		})
+	}
+}
+
+func TestGenerateTunedConfig_RecoveryTime(t *testing.T) {
+	conf, err := GenerateTunedConfig(1000, 0.01, 2*time.Minute)
+	require.NoError(t, err)
+
+	require.Equal(t, 2*time.Minute, conf.RotationFrequency)
+	// A fully blocked flow decays to the recovered probability after exactly recoveryTime
+	require.InDelta(t, recoveredProbability, math.Exp(-conf.Lambda*120), 1e-12)
+	require.Equal(t, 1/float64(defaultTolerableBadRequestsPerBadFlow), conf.Pi)
+	require.Equal(t, pdSlowingFactor*conf.Pi, conf.Pd)
+}
+
+func TestGenerateTunedConfig_InvalidInputs(t *testing.T) {
+	testCases := []struct {
+		name            string
+		expectedClients uint64
+		fpRate          float64
+		recoveryTime    time.Duration
+	}{
+		{name: "zero clients", expectedClients: 0, fpRate: 0.01, recoveryTime: time.Minute},
+		{name: "zero fp rate", expectedClients: 10, fpRate: 0, recoveryTime: time.Minute},
+		{name: "fp rate of one", expectedClients: 10, fpRate: 1, recoveryTime: time.Minute},
+		{name: "NaN fp rate", expectedClients: 10, fpRate: math.NaN(), recoveryTime: time.Minute},
+		{name: "zero recovery time", expectedClients: 10, fpRate: 0.01, recoveryTime: 0},
+		{name: "too many clients", expectedClients: math.MaxUint64, fpRate: 0.01, recoveryTime: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := GenerateTunedConfig(tc.expectedClients, tc.fpRate, tc.recoveryTime)
+
+			require.Error(t, err)
+			require.Nil(t, conf)
+		})
+	}
+}
+
 func TestGenerateTunedStructureConfigWithZeroTolerance(t *testing.T) {
 	// Verify that passing 0 for tolerableBadRequestsPerBadFlow returns an error
 	conf, err := GenerateTunedStructureConfig(1000, 1000, 0)
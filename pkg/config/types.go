@@ -1,6 +1,66 @@
 package config
 
-import "time"
+import (
+	"time"
+
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// Observer receives tracker events so embedders can wire custom alerting or
+// logging. Callbacks run synchronously on the calling goroutine, so they must
+// be fast and must not block. Embed BaseObserver to implement only the
+// callbacks you need.
+type Observer interface {
+	// OnThrottle is called for every throttle decision, including decisions
+	// recorded in the shadow throttle mode. The client identifier must not be
+	// retained or modified.
+	OnThrottle(clientIdentifier []byte, result *request.RegisterRequestResult)
+	// OnRotation is called after the tracker rotates its structures. The
+	// structure with retiredID was discarded and the one with newID was
+	// created to start warming up.
+	OnRotation(retiredID, newID uint64)
+}
+
+// BaseObserver implements Observer with no-op callbacks.
+type BaseObserver struct{}
+
+// OnThrottle does nothing.
+func (BaseObserver) OnThrottle(_ []byte, _ *request.RegisterRequestResult) {}
+
+// OnRotation does nothing.
+func (BaseObserver) OnRotation(_, _ uint64) {}
+
+// ThrottleMode controls what the tracker does with a positive throttling
+// decision.
+type ThrottleMode string
+
+const (
+	// ThrottleModeReject throttles the request outright. This is the default
+	// when no mode is set.
+	ThrottleModeReject ThrottleMode = "reject"
+	// ThrottleModeDelay throttles the request and suggests a retry-after
+	// duration that grows with the final probability.
+	ThrottleModeDelay ThrottleMode = "delay"
+	// ThrottleModeShadow computes decisions but never throttles. The decision
+	// that would have been made is still recorded on the result.
+	ThrottleModeShadow ThrottleMode = "shadow"
+)
+
+// DecisionMode controls how the final probability is turned into a throttling
+// decision.
+type DecisionMode string
+
+const (
+	// DecisionModeProbabilistic throttles a request with a probability equal to
+	// the final probability. This is the default when no mode is set.
+	DecisionModeProbabilistic DecisionMode = "probabilistic"
+	// DecisionModeThreshold throttles a request if and only if the final
+	// probability exceeds DecisionThreshold, making decisions deterministic.
+	DecisionModeThreshold DecisionMode = "threshold"
+	// DecisionModeDefer never throttles and leaves the decision to the caller,
+	// which can act on the final probability in the result.
+	DecisionModeDefer DecisionMode = "defer"
+)
 
 // FairnessTrackerConfig defines the parameters for the underlying data
 // structure used by the fairness tracker. Most users will rely on
@@ -14,12 +74,110 @@ type FairnessTrackerConfig struct {
 	Pi float64
 	// The delta P to subtract from a bucket's probability when there's a success
 	Pd float64
-	// The exponential decay rate for the probabilities
+	// The decay rate for the probabilities. With the default exponential
+	// decay it is the rate per second; other decay functions may interpret
+	// it differently.
 	Lambda float64
+	// The function decaying bucket probabilities over the time since their
+	// last outcome. Defaults to exponential decay when nil.
+	DecayFunction DecayFunction
 	// The frequency of rotation
 	RotationFrequency time.Duration
+	// Number of structures in rotation, including the one making decisions.
+	// The rest warm up with outcomes weighted down the further they are from
+	// taking over, so short rotation frequencies forget history gradually.
+	// Memory grows linearly with it. Defaults to 2 when unset.
+	NumGenerations uint32
 	// Include result stats. Useful for debugging but may slightly affect performance.
 	IncludeStats bool
 	// The function to choose the final probability from all the bucket probabilities
 	FinalProbabilityFunction FinalProbabilityFunction
+	// The function used to hash client identifiers into buckets. Defaults to
+	// MurmurHash3 when nil.
+	HashFunction HashFunction
+	// Rewrites client identifiers before they are tracked, for example to
+	// lowercase them or to replace them with a keyed hash so raw identifiers
+	// are never stored. The tracker and every component it feeds, such as the
+	// observer and the decision cache, only see the rewritten identifiers.
+	// The identity package has ready-made normalizers. Optional.
+	IdentifierNormalizer func(clientIdentifier []byte) []byte
+	// Enables the privacy mode when set. Client identifiers are replaced with
+	// their HMAC-SHA256 under this salt in everything the tracker exposes: the
+	// most throttled clients, observer events and recordings. Decisions still
+	// use the identifiers, so unlike an HMAC IdentifierNormalizer the salt can
+	// be rotated without resetting the flows. Look clients up with
+	// tracker.PrivateClientIdentifier. Keep the salt secret.
+	PrivacySalt []byte
+	// Makes the hash seeds of the structures reproducible. Every structure
+	// still gets a different seed, derived from this one and its ID. Zero
+	// picks random seeds. Set it to replay recorded traffic exactly.
+	HashSeed uint32
+	// How the final probability is turned into a decision. Defaults to
+	// DecisionModeProbabilistic.
+	DecisionMode DecisionMode
+	// The final probability above which requests are throttled in
+	// DecisionModeThreshold
+	DecisionThreshold float64
+	// Share of requests let through even when the decision is to throttle, so
+	// the outcomes of a fully throttled client keep being observed and it can
+	// recover. For example, 0.01 admits about 1% of them. Must be in [0, 1).
+	// Zero disables it.
+	MinPassRate float64
+	// What to do with a positive throttling decision. Defaults to ThrottleModeReject.
+	ThrottleMode ThrottleMode
+	// The retry-after suggested for a request with final probability 1 in
+	// ThrottleModeDelay. Lower probabilities scale it down linearly.
+	MaxRetryAfter time.Duration
+	// Number of clients to track in the most throttled clients sketch. Zero
+	// disables tracking.
+	TopThrottledClientsCapacity uint32
+	// Absolute request rate allowed per client, enforced by a token bucket in
+	// front of the fairness structure. Zero disables rate limiting.
+	MaxRPS float64
+	// Number of requests a client can burst above MaxRPS. Treated as 1 if unset.
+	Burst uint32
+	// Number of clients whose final probability is cached so very hot clients
+	// skip the buckets. Decisions are still made per request. Zero disables the
+	// cache.
+	DecisionCacheSize uint32
+	// How long a cached final probability is used. It bounds how stale
+	// decisions can get, so keep it short, such as 10ms.
+	DecisionCacheTTL time.Duration
+	// How long a request admitted by RegisterRequest stays pending while
+	// waiting for its outcome to be reported with ReportOutcomeByToken.
+	// Requests not reported in time are reported as timeouts. Zero disables
+	// pending request tracking and no tokens are issued.
+	PendingRequestTTL time.Duration
+	// Number of recent clients of a shared resource that share the blame for
+	// outcomes reported against it with ReportResourceOutcome. The heaviest
+	// users are kept, so it caps the blast radius of a resource failure. Zero
+	// disables resource attribution.
+	ResourceBlastRadius uint32
+	// Weights of the tenant and the user in the final probability of requests
+	// registered with RegisterTieredRequest, which is the weighted mean of the
+	// probabilities of both levels. A higher UserWeight confines throttling to
+	// the misbehaving users of a tenant, a higher TenantWeight spreads it over
+	// the whole tenant. Equal weights are used when both are zero.
+	TenantWeight float64
+	UserWeight   float64
+	// Receives tracker events. Optional.
+	Observer Observer
+	// Multipliers applied to Pi for failure-like outcomes, for example to make
+	// timeouts count twice as much as failures. Outcomes not in the map use
+	// their defaults: 1 for failures, timeouts and rejections and 0 for client
+	// errors. Successes always use Pd and cannot be set here.
+	OutcomeMultipliers map[request.Outcome]float64
+	// Multipliers applied to the final probability of requests with the given
+	// priority, capped at 1. For example, 2 for low priority and 0.5 for high
+	// priority requests sheds the low priority traffic of a misbehaving client
+	// first. Priorities not in the map use 1.
+	PriorityMultipliers map[request.Priority]float64
+	// Latencies reported through ReportLatency at or below this value count as
+	// successes.
+	LatencyTarget time.Duration
+	// Latencies reported through ReportLatency at or above this value count as
+	// full failures. Latencies between LatencyTarget and LatencyLimit count as
+	// partial failures that grow linearly with the latency. Zero disables
+	// latency reporting.
+	LatencyLimit time.Duration
 }
@@ -2,14 +2,17 @@ package data
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"math"
 	"math/rand"
 	"sync"
-
-	"github.com/spaolacci/murmur3"
+	"time"
 
 	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/config/decay"
+	"github.com/satmihir/fair/pkg/config/hashers"
+	"github.com/satmihir/fair/pkg/fairerrors"
 	"github.com/satmihir/fair/pkg/request"
 	"github.com/satmihir/fair/pkg/utils"
 )
@@ -43,19 +46,33 @@ type Structure struct {
 	config *config.FairnessTrackerConfig
 	// The unique ID of the structure
 	id uint64
-	// The murmur hash seed
+	// The hash seed
 	murmurSeed uint32
+	// The function hashing client identifiers into buckets
+	hashFunction config.HashFunction
+	// The function decaying bucket probabilities over time
+	decayFunction config.DecayFunction
 	// The clock to use for getting the time
 	clock utils.IClock
 	// Includes stats in results. Useful for debugging but may slightly affect performance.
 	includeStats bool
+	// Pi multiplier for every failure-like outcome, with config overrides applied
+	outcomeMultipliers map[request.Outcome]float64
+}
+
+// The Pi multipliers used for outcomes not overridden in the config
+var defaultOutcomeMultipliers = map[request.Outcome]float64{
+	request.OutcomeFailure:     1,
+	request.OutcomeTimeout:     1,
+	request.OutcomeRejected:    1,
+	request.OutcomeClientError: 0,
 }
 
 // NewStructureWithClock creates a Structure using the provided clock. This is
 // primarily used in tests and simulations where time needs to be controlled.
 func NewStructureWithClock(config *config.FairnessTrackerConfig, id uint64, includeStats bool, clock utils.IClock) (*Structure, error) {
-	if err := validateStructureConfig(config); err != nil {
-		return nil, NewDataError(err, "The input config failed validation: %v", config)
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
 	}
 
 	levels := make([][]*bucket, config.L)
@@ -67,16 +84,57 @@ func NewStructureWithClock(config *config.FairnessTrackerConfig, id uint64, incl
 		}
 	}
 
+	hashFunction := config.HashFunction
+	if hashFunction == nil {
+		hashFunction = hashers.Murmur3
+	}
+	decayFunction := config.DecayFunction
+	if decayFunction == nil {
+		decayFunction = decay.Exponential
+	}
+
+	// Copy the multipliers so later changes to the config map can't race with requests
+	outcomeMultipliers := make(map[request.Outcome]float64, len(defaultOutcomeMultipliers))
+	for outcome, multiplier := range defaultOutcomeMultipliers {
+		outcomeMultipliers[outcome] = multiplier
+	}
+	for outcome, multiplier := range config.OutcomeMultipliers {
+		outcomeMultipliers[outcome] = multiplier
+	}
+
+	murmurSeed := rand.Uint32()
+	if config.HashSeed != 0 {
+		var idBytes [8]byte
+		binary.LittleEndian.PutUint64(idBytes[:], id)
+		h1, _ := hashers.Murmur3(idBytes[:], config.HashSeed)
+		murmurSeed = uint32(h1)
+	}
+
 	return &Structure{
-		levels:       levels,
-		config:       config,
-		id:           id,
-		murmurSeed:   rand.Uint32(),
-		clock:        clock,
-		includeStats: includeStats,
+		levels:             levels,
+		config:             config,
+		id:                 id,
+		murmurSeed:         murmurSeed,
+		hashFunction:       hashFunction,
+		decayFunction:      decayFunction,
+		clock:              clock,
+		includeStats:       includeStats,
+		outcomeMultipliers: outcomeMultipliers,
 	}, nil
 }
 
+// ValidateConfig checks the given config against the invariants a Structure
+// requires, returning the same error NewStructure would.
+func ValidateConfig(config *config.FairnessTrackerConfig) error {
+	if err := validateStructureConfig(config); err != nil {
+		// Errors end up in logs, so they must not carry the salt
+		redacted := *config
+		redacted.PrivacySalt = nil
+		return NewDataError(err, "The input config failed validation: %v", &redacted).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	return nil
+}
+
 // NewStructure creates a Structure using the real system clock.
 func NewStructure(config *config.FairnessTrackerConfig, id uint64, includeStats bool) (*Structure, error) {
 	return NewStructureWithClock(config, id, includeStats, utils.NewRealClock())
@@ -87,23 +145,158 @@ func (s *Structure) GetID() uint64 {
 	return s.id
 }
 
+// GetSeed returns the seed client identifiers are hashed with.
+func (s *Structure) GetSeed() uint32 {
+	return s.murmurSeed
+}
+
+// ProbabilityMatrix returns a snapshot of the decayed probability of every
+// bucket, indexed by level and then by bucket. It is meant for visualizing how
+// saturated the structure is: when most buckets carry a high probability, M is
+// too small for the client population. The buckets are not modified.
+func (s *Structure) ProbabilityMatrix() [][]float64 {
+	now := s.currentMillis()
+
+	matrix := make([][]float64, len(s.levels))
+	for l, lvl := range s.levels {
+		matrix[l] = make([]float64, len(lvl))
+		for m, buck := range lvl {
+			buck.mu.Lock()
+			matrix[l][m] = s.decayedProbability(buck, now)
+			buck.mu.Unlock()
+		}
+	}
+
+	return matrix
+}
+
+// NewResizedStructure creates a structure with the geometry of the given config
+// that carries over the state of an existing structure, so M and L can change
+// without forgetting which clients were misbehaving. The new structure keeps
+// the ID, hash function and seed of the old one, which means a client's bucket
+// at a level only moves because the level has a different size.
+//
+// The projection is best-effort. Every new bucket gets the highest probability
+// among the old buckets its clients may have hashed to, which is an upper
+// bound of the probability they had. It is exact when the new M is a multiple
+// of the old M and no levels are added. Shrinking M to a divisor merges
+// buckets, and added levels take the highest probability of the old structure,
+// which the default minimum aggregator ignores for clients that are low on the
+// other levels. Sizes that share no common factor with the old M lose
+// precision on that level, since any old bucket may then be a candidate.
+func NewResizedStructure(config *config.FairnessTrackerConfig, from *Structure, clock utils.IClock) (*Structure, error) {
+	s, err := NewStructureWithClock(config, from.id, from.includeStats, clock)
+	if err != nil {
+		return nil, err
+	}
+	s.murmurSeed = from.murmurSeed
+	s.hashFunction = from.hashFunction
+
+	matrix := from.ProbabilityMatrix()
+	var highest float64
+	for _, row := range matrix {
+		for _, p := range row {
+			highest = max(highest, p)
+		}
+	}
+
+	for l, lvl := range s.levels {
+		if l >= len(matrix) {
+			// A new level hashes independently of the old ones, so any old
+			// bucket is a candidate
+			for _, b := range lvl {
+				b.probability = highest
+			}
+			continue
+		}
+
+		// Clients land in bucket (h1 + l*h2) mod M, so a client in new
+		// bucket j came from an old bucket congruent to j modulo the GCD of
+		// the two sizes
+		g := gcd(len(matrix[l]), len(lvl))
+		classes := make([]float64, g)
+		for i, p := range matrix[l] {
+			classes[i%g] = max(classes[i%g], p)
+		}
+		for j, b := range lvl {
+			b.probability = classes[j%g]
+		}
+	}
+
+	return s, nil
+}
+
+// WithConfig returns a structure that shares the buckets of this one but reads
+// its tunables, such as Pi, Pd, Lambda and the decision and throttle modes,
+// from the given config. This lets tunables change without mutating a config
+// that concurrent requests are reading. The geometry of the config must match
+// the structure. The ID, seed, hash function, decay function and outcome
+// multipliers are kept.
+func (s *Structure) WithConfig(conf *config.FairnessTrackerConfig) *Structure {
+	updated := *s
+	updated.config = conf
+	return &updated
+}
+
+// The greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
 // Close releases any resources associated with the Structure.
 func (s *Structure) Close() {
 }
 
+// Pool of bucket probability slices reused across requests when stats are
+// disabled, so registering a request doesn't allocate
+var probabilitiesPool = sync.Pool{
+	New: func() any {
+		return new([]float64)
+	},
+}
+
 // RegisterRequest records an incoming request from the client and returns the
 // throttling decision based on current probabilities.
-func (s *Structure) RegisterRequest(_ context.Context, clientIdentifier []byte) *request.RegisterRequestResult {
+func (s *Structure) RegisterRequest(ctx context.Context, clientIdentifier []byte) *request.RegisterRequestResult {
+	result := &request.RegisterRequestResult{}
+	s.RegisterRequestInto(ctx, clientIdentifier, result)
+	return result
+}
+
+// RegisterRequestInto works like RegisterRequest but writes the decision into
+// the given result, overwriting its previous contents. Reusing results this way
+// avoids allocating on the hot path when stats are disabled.
+func (s *Structure) RegisterRequestInto(ctx context.Context, clientIdentifier []byte, result *request.RegisterRequestResult) {
+	if err := ctx.Err(); err != nil {
+		*result = request.RegisterRequestResult{Err: err}
+		return
+	}
+
 	var stats *request.ResultStats
 
-	bucketProbabilities := make([]float64, s.config.L)
+	// Stats keep the probabilities, so only borrow the slice when they're disabled
+	var bucketProbabilities []float64
+	if s.includeStats {
+		bucketProbabilities = make([]float64, s.config.L)
+	} else {
+		pooled := probabilitiesPool.Get().(*[]float64)
+		defer probabilitiesPool.Put(pooled)
+		if cap(*pooled) < int(s.config.L) {
+			*pooled = make([]float64, s.config.L)
+		}
+		bucketProbabilities = (*pooled)[:s.config.L]
+	}
 
-	// We can ignore the error since the handler never returns one
-	s.visitBuckets(clientIdentifier, func(l uint32, m uint32, b *bucket) {
-		bucketProbabilities[l] = b.probability
+	s.peekBuckets(clientIdentifier, func(l uint32, m uint32, probability float64) {
+		bucketProbabilities[l] = probability
 		if s.includeStats {
 			if stats == nil {
 				stats = &request.ResultStats{
+					StructureID:   s.id,
+					HashSeed:      s.murmurSeed,
 					BucketIndexes: make([]int, s.config.L),
 				}
 			}
@@ -111,74 +304,182 @@ func (s *Structure) RegisterRequest(_ context.Context, clientIdentifier []byte)
 		}
 	})
 
-	pFinal := s.config.FinalProbabilityFunction(bucketProbabilities)
+	pFinal := clampProbability(s.config.FinalProbabilityFunction(bucketProbabilities))
 
 	if s.includeStats {
 		stats.BucketProbabilities = bucketProbabilities
 		stats.FinalProbability = pFinal
 	}
 
+	*result = request.RegisterRequestResult{
+		ResultStats: stats,
+	}
+	Decide(s.config, pFinal, result)
+}
+
+// Decide makes the throttling decision for a request with the given final
+// probability according to the decision and throttle modes in the config, and
+// records it in the result. Fields of the result unrelated to the decision are
+// left untouched.
+func Decide(conf *config.FairnessTrackerConfig, pFinal float64, result *request.RegisterRequestResult) {
+	decide(conf, pFinal, rand.Float64, rand.Float64, result)
+}
+
+// Draws are the random numbers in [0, 1) a decision is based on. Deciding for
+// several configs with the same draws makes their decisions comparable, since
+// they only differ where the configs do.
+type Draws struct {
+	// Compared against the final probability in the probabilistic mode
+	Throttle float64
+	// Compared against MinPassRate to let a throttled request through
+	Pass float64
+}
+
+// NewDraws returns fresh random draws.
+func NewDraws() Draws {
+	return Draws{Throttle: rand.Float64(), Pass: rand.Float64()}
+}
+
+// DecideWithDraws works like Decide but bases the decision on the given draws.
+func DecideWithDraws(conf *config.FairnessTrackerConfig, pFinal float64, draws Draws, result *request.RegisterRequestResult) {
+	decide(conf, pFinal, func() float64 { return draws.Throttle }, func() float64 { return draws.Pass }, result)
+}
+
+// Make the decision, only drawing the random numbers it needs
+func decide(conf *config.FairnessTrackerConfig, pFinal float64, throttleDraw, passDraw func() float64, result *request.RegisterRequestResult) {
 	// Decide whether to throttle the request based on the probability
 	shouldThrottle := false
-	if rand.Float64() <= pFinal {
-		shouldThrottle = true
+	switch conf.DecisionMode {
+	case config.DecisionModeThreshold:
+		shouldThrottle = pFinal > conf.DecisionThreshold
+	case config.DecisionModeDefer:
+	default:
+		shouldThrottle = throttleDraw() <= pFinal
+	}
+
+	// Let a small random share of throttled requests through so a client
+	// that stopped misbehaving gets the successes it needs to recover
+	if shouldThrottle && conf.MinPassRate > 0 && passDraw() < conf.MinPassRate {
+		shouldThrottle = false
 	}
 
-	return &request.RegisterRequestResult{
-		ShouldThrottle: shouldThrottle,
-		ResultStats:    stats,
+	result.FinalProbability = pFinal
+	result.ShouldThrottle = false
+	result.ShadowThrottled = false
+	result.RetryAfter = 0
+
+	switch conf.ThrottleMode {
+	case config.ThrottleModeShadow:
+		result.ShadowThrottled = shouldThrottle
+	case config.ThrottleModeDelay:
+		result.ShouldThrottle = shouldThrottle
+		if shouldThrottle {
+			result.RetryAfter = time.Duration(pFinal * float64(conf.MaxRetryAfter))
+		}
+	default:
+		result.ShouldThrottle = shouldThrottle
 	}
 }
 
 // ReportOutcome updates the probabilities for the buckets associated with the
 // given client identifier based on the observed outcome.
-func (s *Structure) ReportOutcome(_ context.Context, clientIdentifier []byte, outcome request.Outcome) *request.ReportOutcomeResult {
-	adjustment := s.config.Pi
-	if outcome == request.OutcomeSuccess {
-		adjustment = -s.config.Pd
+func (s *Structure) ReportOutcome(ctx context.Context, clientIdentifier []byte, outcome request.Outcome) *request.ReportOutcomeResult {
+	return s.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, 1)
+}
+
+// ReportOutcomeWithCost works like ReportOutcome but scales the probability
+// adjustment by the cost of the request, so expensive requests move the
+// buckets further than cheap ones. A cost of 1 is equivalent to ReportOutcome
+// and a cost that is not a positive number, including NaN, leaves the buckets
+// untouched.
+func (s *Structure) ReportOutcomeWithCost(_ context.Context, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	if !(cost > 0) {
+		return request.ReportOutcomeOK
 	}
 
-	s.visitBuckets(clientIdentifier, func(_ uint32, _ uint32, b *bucket) {
-		p := b.probability + adjustment
-		if p < 0 {
-			p = 0
+	var adjustment float64
+	if outcome == request.OutcomeSuccess {
+		adjustment = -s.config.Pd * cost
+	} else {
+		// Outcomes we don't know about are treated as plain failures
+		multiplier, ok := s.outcomeMultipliers[outcome]
+		if !ok {
+			multiplier = 1
 		}
-
-		if p > 1 {
-			p = 1
+		if multiplier == 0 {
+			return request.ReportOutcomeOK
 		}
+		adjustment = s.config.Pi * multiplier * cost
+	}
 
-		b.probability = p
+	s.visitBuckets(clientIdentifier, func(_ uint32, _ uint32, b *bucket) {
+		b.probability = clampProbability(b.probability + adjustment)
 		b.lastUpdatedTimeMillis = s.currentMillis()
 	})
 
-	return &request.ReportOutcomeResult{}
+	return request.ReportOutcomeOK
 }
 
 // Visit the buckets belonging to the given clientIdentifier
 // Also takes the bucket lock and manages probability decay prior to calling the handler
 func (s *Structure) visitBuckets(clientIdentifier []byte, fn func(uint32, uint32, *bucket)) {
-	levelHashes := generateNHashesUsing64Bit(clientIdentifier, s.config.L, s.murmurSeed)
+	h1, h2 := s.hashFunction(clientIdentifier, s.murmurSeed)
 
 	for l := 0; l < int(s.config.L); l++ {
 		lvl := s.levels[l]
-		m := levelHashes[l] % s.config.M
+		m := levelIndex(h1, h2, uint32(l), s.config.M)
 		buck := lvl[m]
 
 		buck.mu.Lock()
 
 		cur := s.currentMillis()
-		deltaT := cur - buck.lastUpdatedTimeMillis
-		pm := adjustProbability(buck.probability, s.config.Lambda, deltaT)
-
+		buck.probability = s.decayedProbability(buck, cur)
 		buck.lastUpdatedTimeMillis = cur
-		buck.probability = pm
 
 		fn(uint32(l), m, buck)
 		buck.mu.Unlock()
 	}
 }
 
+// Read the decayed probabilities of the buckets belonging to the given
+// clientIdentifier without updating them. Registering requests only reads
+// the buckets, so the time since the last outcome keeps counting for decay
+// functions that aren't memoryless, such as windows.
+func (s *Structure) peekBuckets(clientIdentifier []byte, fn func(uint32, uint32, float64)) {
+	h1, h2 := s.hashFunction(clientIdentifier, s.murmurSeed)
+	now := s.currentMillis()
+
+	for l := 0; l < int(s.config.L); l++ {
+		m := levelIndex(h1, h2, uint32(l), s.config.M)
+		buck := s.levels[l][m]
+
+		buck.mu.Lock()
+		probability := s.decayedProbability(buck, now)
+		buck.mu.Unlock()
+
+		fn(uint32(l), m, probability)
+	}
+}
+
+// The probability of the bucket decayed up to the given time. The caller must
+// hold the bucket lock.
+func (s *Structure) decayedProbability(b *bucket, now uint64) float64 {
+	var elapsed time.Duration
+	if now > b.lastUpdatedTimeMillis {
+		elapsed = time.Duration(now-b.lastUpdatedTimeMillis) * time.Millisecond
+	}
+	return clampProbability(s.decayFunction(b.probability, s.config.Lambda, elapsed))
+}
+
+// Clamp a probability to [0, 1]. NaN becomes 0 so a single bad value, such as
+// one returned by a custom function, can't poison a bucket forever.
+func clampProbability(p float64) float64 {
+	if !(p > 0) {
+		return 0
+	}
+	return min(p, 1)
+}
+
 func (s *Structure) currentMillis() uint64 {
 	return uint64(s.clock.Now().UnixMilli())
 }
@@ -186,14 +487,14 @@ func (s *Structure) currentMillis() uint64 {
 // Validate the input config against invariants
 func validateStructureConfig(config *config.FairnessTrackerConfig) error {
 	if config == nil {
-		return NewDataError(nil, "FairnessTrackerConfig cannot be nil")
+		return NewDataError(nil, "FairnessTrackerConfig cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
 	}
 
 	if config.L <= 0 || config.M <= 0 {
 		return fmt.Errorf("the values of L and M must be at least 1, found L: %d and M: %d", config.L, config.M)
 	}
 
-	if config.Pd <= 0 || config.Pi <= 0 {
+	if !(config.Pd > 0) || !(config.Pi > 0) {
 		return fmt.Errorf("the values of Pi and Pd must >0, found Pi: %f and Pd: %f", config.Pi, config.Pd)
 	}
 
@@ -201,36 +502,99 @@ func validateStructureConfig(config *config.FairnessTrackerConfig) error {
 		return fmt.Errorf("the values of Pi and Pd must <=1, found Pi: %f and Pd: %f", config.Pi, config.Pd)
 	}
 
+	if !(config.Lambda >= 0) || math.IsInf(config.Lambda, 0) {
+		return fmt.Errorf("the value of Lambda must be a finite value >=0, found: %f", config.Lambda)
+	}
+
 	// The expectation is we quickly throttle the client when bad things start to happen
 	// but cautiously bring it back to avoid retry-storms.
 	if config.Pi <= config.Pd {
 		return fmt.Errorf("the value of Pd is expected to be smaller than Pi")
 	}
 
+	if err := validateOutcomeMultipliers(config.OutcomeMultipliers); err != nil {
+		return err
+	}
+
+	if err := validatePriorityMultipliers(config.PriorityMultipliers); err != nil {
+		return err
+	}
+
+	if err := validateDecisionMode(config.DecisionMode, config.DecisionThreshold); err != nil {
+		return err
+	}
+
+	if !(config.MinPassRate >= 0 && config.MinPassRate < 1) {
+		return fmt.Errorf("the value of MinPassRate must be in [0, 1), found: %f", config.MinPassRate)
+	}
+
+	return validateThrottleMode(config.ThrottleMode, config.MaxRetryAfter)
+}
+
+// Validate the Pi multipliers configured for failure-like outcomes
+func validateOutcomeMultipliers(multipliers map[request.Outcome]float64) error {
+	for outcome, multiplier := range multipliers {
+		if _, ok := defaultOutcomeMultipliers[outcome]; !ok {
+			return fmt.Errorf("no Pi multiplier can be set for outcome: %d", outcome)
+		}
+		if multiplier < 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+			return fmt.Errorf("the Pi multiplier for outcome %d must be a finite value >=0, found: %f", outcome, multiplier)
+		}
+	}
 	return nil
 }
 
-// Calculate n hashes of the given input using murmur hash.
-// To optimize, we only calculate a single 64-bit hash and use a technique outlined in
-// the paper below to compute more based on them:
-// https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
-func generateNHashesUsing64Bit(input []byte, n uint32, seed uint32) []uint32 {
-	// Compute the 64-bit hash
-	h := murmur3.New64WithSeed(seed)
-	h.Write(input)
-	hash64 := h.Sum64()
+// Validate the probability multipliers configured for priorities
+func validatePriorityMultipliers(multipliers map[request.Priority]float64) error {
+	for priority, multiplier := range multipliers {
+		switch priority {
+		case request.PriorityNormal, request.PriorityHigh, request.PriorityLow:
+		default:
+			return fmt.Errorf("unknown priority in priority multipliers: %d", priority)
+		}
+		if multiplier < 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+			return fmt.Errorf("the multiplier for priority %d must be a finite value >=0, found: %f", priority, multiplier)
+		}
+	}
+	return nil
+}
 
-	// Split the 64-bit hash into two 32-bit hashes
-	hash1 := uint32(hash64)       // Lower 32 bits
-	hash2 := uint32(hash64 >> 32) // Upper 32 bits
+// Validate the decision mode and the parameters it depends on
+func validateDecisionMode(mode config.DecisionMode, threshold float64) error {
+	switch mode {
+	case "", config.DecisionModeProbabilistic, config.DecisionModeDefer:
+		return nil
+	case config.DecisionModeThreshold:
+		if !(threshold >= 0 && threshold <= 1) {
+			return fmt.Errorf("the value of DecisionThreshold must be in [0, 1] in threshold mode, found: %f", threshold)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown decision mode: %q", mode)
+	}
+}
 
-	// Generate the n hashes using the combination: hash_i = hash1 + i * hash2
-	hashes := make([]uint32, n)
-	for i := 0; i < int(n); i++ {
-		hashes[i] = hash1 + uint32(i)*hash2
+// Validate the throttle mode and the parameters it depends on
+func validateThrottleMode(mode config.ThrottleMode, maxRetryAfter time.Duration) error {
+	switch mode {
+	case "", config.ThrottleModeReject, config.ThrottleModeShadow:
+		return nil
+	case config.ThrottleModeDelay:
+		if maxRetryAfter <= 0 {
+			return fmt.Errorf("the value of MaxRetryAfter must be >0 in delay mode, found: %v", maxRetryAfter)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown throttle mode: %q", mode)
 	}
+}
 
-	return hashes
+// Derive the bucket index at the given level from a 128-bit hash.
+// Rather than computing a hash per level, we combine the two 64-bit halves
+// using the technique outlined in the paper below:
+// https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
+func levelIndex(h1, h2 uint64, level uint32, m uint32) uint32 {
+	return uint32((h1 + uint64(level)*h2) % uint64(m))
 }
 
 // AdjustProbability applies exponential decay to the given probability.
@@ -238,11 +602,5 @@ func generateNHashesUsing64Bit(input []byte, n uint32, seed uint32) []uint32 {
 // lambda: the decay rate (higher values mean faster decay)
 // deltaMs: the time difference in milliseconds
 func adjustProbability(prob float64, lambda float64, deltaMs uint64) float64 {
-	deltaSec := float64(deltaMs) / 1000.0
-	decayedProb := prob * math.Exp(-lambda*deltaSec)
-
-	if decayedProb < 0 {
-		return 0
-	}
-	return decayedProb
+	return decay.Exponential(prob, lambda, time.Duration(deltaMs)*time.Millisecond)
 }
@@ -2,13 +2,18 @@ package data
 
 import (
 	"context"
+	"fmt"
 	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/config/hashers"
+	"github.com/satmihir/fair/pkg/fairerrors"
 	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -68,6 +73,16 @@ func TestValidateStructConfig(t *testing.T) {
 
 	err = validateStructureConfig(conf)
 	assert.NoError(t, err)
+
+	for _, invalid := range []*config.FairnessTrackerConfig{
+		{L: 1, M: 1, Pd: .1, Pi: math.NaN()},
+		{L: 1, M: 1, Pd: math.NaN(), Pi: .15},
+		{L: 1, M: 1, Pd: .1, Pi: .15, Lambda: -1},
+		{L: 1, M: 1, Pd: .1, Pi: .15, Lambda: math.NaN()},
+		{L: 1, M: 1, Pd: .1, Pi: .15, Lambda: math.Inf(1)},
+	} {
+		assert.Error(t, validateStructureConfig(invalid), "Pi: %f, Pd: %f, Lambda: %f", invalid.Pi, invalid.Pd, invalid.Lambda)
+	}
 }
 
 func TestNewStructureFailsValidation(t *testing.T) {
@@ -79,6 +94,20 @@ func TestNewStructureFailsValidation(t *testing.T) {
 	}
 	_, err := NewStructure(conf, 1, true)
 	assert.Error(t, err)
+	assert.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+}
+
+func TestValidateConfig_RedactsPrivacySalt(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = -1
+	conf.PrivacySalt = []byte("topsecret")
+
+	err := ValidateConfig(conf)
+
+	require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+	assert.NotContains(t, err.Error(), "topsecret")
+	assert.NotContains(t, err.Error(), fmt.Sprint(conf.PrivacySalt))
+	assert.Equal(t, []byte("topsecret"), conf.PrivacySalt, "the config must not be modified")
 }
 
 func TestNewStructure(t *testing.T) {
@@ -96,17 +125,184 @@ func TestNewStructure(t *testing.T) {
 	assert.Equal(t, len(structure.levels[0]), 24)
 }
 
-func TestHashes(t *testing.T) {
-	datum := []byte("hello world")
-	hashes := generateNHashesUsing64Bit(datum, 3, 5)
+func TestLevelIndex(t *testing.T) {
+	h1, h2 := hashers.Murmur3([]byte("hello world"), 5)
 
-	assert.Equal(t, len(hashes), 3)
+	indexes := make([]uint32, 3)
+	for l := range indexes {
+		indexes[l] = levelIndex(h1, h2, uint32(l), 24)
+		assert.Less(t, indexes[l], uint32(24))
+	}
 
-	hashes2 := generateNHashesUsing64Bit(datum, 3, 5)
+	assert.Equal(t, uint32(h1%24), indexes[0])
+	assert.Equal(t, uint32((h1+h2)%24), indexes[1])
+	assert.Equal(t, uint32((h1+2*h2)%24), indexes[2])
+}
 
-	assert.Equal(t, hashes[0], hashes2[0])
-	assert.Equal(t, hashes[1], hashes2[1])
-	assert.Equal(t, hashes[2], hashes2[2])
+func TestCustomHashFunction(t *testing.T) {
+	var hashed [][]byte
+	conf := &config.FairnessTrackerConfig{
+		L:  3,
+		M:  10,
+		Pd: .1,
+		Pi: .15,
+		HashFunction: func(input []byte, _ uint32) (uint64, uint64) {
+			hashed = append(hashed, input)
+			return 4, 3
+		},
+		FinalProbabilityFunction: config.MinFinalProbabilityFunction,
+	}
+	structure, err := NewStructure(conf, 1, true)
+	require.NoError(t, err)
+
+	resp := structure.RegisterRequest(context.Background(), []byte("client"))
+
+	require.Equal(t, [][]byte{[]byte("client")}, hashed)
+	require.Equal(t, []int{4, 7, 0}, resp.ResultStats.BucketIndexes)
+	require.Equal(t, uint64(1), resp.ResultStats.StructureID)
+	require.Equal(t, structure.murmurSeed, resp.ResultStats.HashSeed)
+}
+
+func TestProbabilityMatrix(t *testing.T) {
+	conf := &config.FairnessTrackerConfig{
+		L:  3,
+		M:  5,
+		Pi: 0.1,
+		Pd: 0.01,
+	}
+	structure, err := NewStructure(conf, 1, false)
+	require.NoError(t, err)
+	clientID := []byte("client")
+
+	structure.ReportOutcome(context.Background(), clientID, request.OutcomeFailure)
+	matrix := structure.ProbabilityMatrix()
+
+	require.Len(t, matrix, 3)
+	for l, row := range matrix {
+		require.Len(t, row, 5)
+		var sum float64
+		for _, p := range row {
+			sum += p
+		}
+		require.InDelta(t, 0.1, sum, 1e-9, "exactly one bucket per level should be hit at level %d", l)
+	}
+	structure.visitBuckets(clientID, func(l, m uint32, b *bucket) {
+		require.InDelta(t, b.probability, matrix[l][m], 1e-9)
+	})
+}
+
+func TestWithConfig(t *testing.T) {
+	conf := &config.FairnessTrackerConfig{
+		L:                        2,
+		M:                        4,
+		Pi:                       0.5,
+		Pd:                       0.1,
+		FinalProbabilityFunction: config.MinFinalProbabilityFunction,
+	}
+	structure, err := NewStructure(conf, 7, false)
+	require.NoError(t, err)
+	ctx := context.Background()
+	clientID := []byte("client")
+	structure.ReportOutcome(ctx, clientID, request.OutcomeFailure)
+
+	updatedConf := *conf
+	updatedConf.Pi = 0.25
+	updated := structure.WithConfig(&updatedConf)
+	updated.ReportOutcome(ctx, clientID, request.OutcomeFailure)
+
+	require.Equal(t, structure.GetID(), updated.GetID())
+	require.InDelta(t, 0.75, updated.RegisterRequest(ctx, clientID).FinalProbability, 1e-9)
+	require.InDelta(t, 0.75, structure.RegisterRequest(ctx, clientID).FinalProbability, 1e-9, "the buckets should be shared")
+	require.Equal(t, 0.5, conf.Pi, "the original config should not change")
+}
+
+func TestNewResizedStructure(t *testing.T) {
+	conf := &config.FairnessTrackerConfig{
+		L:                        2,
+		M:                        4,
+		Pi:                       0.5,
+		Pd:                       0.1,
+		FinalProbabilityFunction: config.MinFinalProbabilityFunction,
+	}
+	structure, err := NewStructure(conf, 7, false)
+	require.NoError(t, err)
+	ctx := context.Background()
+	clientID := []byte("client")
+	structure.ReportOutcome(ctx, clientID, request.OutcomeFailure)
+	old := structure.ProbabilityMatrix()
+
+	resize := func(l, m uint32) *Structure {
+		resizedConf := *conf
+		resizedConf.L = l
+		resizedConf.M = m
+		resized, err := NewResizedStructure(&resizedConf, structure, utils.NewRealClock())
+		require.NoError(t, err)
+		require.Equal(t, structure.GetID(), resized.GetID())
+		return resized
+	}
+
+	t.Run("growing M to a multiple is exact", func(t *testing.T) {
+		resized := resize(2, 8)
+
+		matrix := resized.ProbabilityMatrix()
+		for l, row := range matrix {
+			for j, p := range row {
+				require.Equal(t, old[l][j%4], p)
+			}
+		}
+		require.Equal(t, 0.5, resized.RegisterRequest(ctx, clientID).FinalProbability)
+	})
+
+	t.Run("shrinking M merges buckets", func(t *testing.T) {
+		resized := resize(2, 2)
+
+		matrix := resized.ProbabilityMatrix()
+		for l, row := range matrix {
+			for j, p := range row {
+				require.Equal(t, max(old[l][j], old[l][j+2]), p)
+			}
+		}
+		require.Equal(t, 0.5, resized.RegisterRequest(ctx, clientID).FinalProbability)
+	})
+
+	t.Run("added levels take the highest probability", func(t *testing.T) {
+		resized := resize(3, 4)
+
+		matrix := resized.ProbabilityMatrix()
+		require.Equal(t, old, matrix[:2])
+		for _, p := range matrix[2] {
+			require.Equal(t, 0.5, p)
+		}
+		require.Equal(t, 0.5, resized.RegisterRequest(ctx, clientID).FinalProbability)
+	})
+
+	t.Run("invalid geometry", func(t *testing.T) {
+		resizedConf := *conf
+		resizedConf.M = 0
+
+		_, err := NewResizedStructure(&resizedConf, structure, utils.NewRealClock())
+
+		require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+	})
+}
+
+func TestHashSeed(t *testing.T) {
+	conf := &config.FairnessTrackerConfig{
+		L:        3,
+		M:        1000,
+		Pi:       0.1,
+		Pd:       0.01,
+		HashSeed: 42,
+	}
+	first, err := NewStructure(conf, 1, false)
+	require.NoError(t, err)
+	same, err := NewStructure(conf, 1, false)
+	require.NoError(t, err)
+	next, err := NewStructure(conf, 2, false)
+	require.NoError(t, err)
+
+	require.Equal(t, first.murmurSeed, same.murmurSeed, "structures with the same ID should share the seed")
+	require.NotEqual(t, first.murmurSeed, next.murmurSeed, "structures with different IDs should not share the seed")
 }
 
 func TestGetID(t *testing.T) {
@@ -240,6 +436,7 @@ func TestValidateStructConfig_NilConfig(t *testing.T) {
 
 	// Error message should clearly state the root cause
 	assert.Contains(t, err.Error(), "cannot be nil")
+	assert.ErrorIs(t, err, fairerrors.ErrNilConfig)
 }
 
 func TestRegisterRequestCallsFinalProbabilityFunction(t *testing.T) {
@@ -440,3 +637,597 @@ func TestReportOutcomeClamping_Concurrent(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateStructConfig_ThrottleMode(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mode          config.ThrottleMode
+		maxRetryAfter time.Duration
+		wantErr       bool
+	}{
+		{name: "unset mode defaults to reject", mode: ""},
+		{name: "reject", mode: config.ThrottleModeReject},
+		{name: "shadow", mode: config.ThrottleModeShadow},
+		{name: "delay with retry-after", mode: config.ThrottleModeDelay, maxRetryAfter: time.Second},
+		{name: "delay without retry-after", mode: config.ThrottleModeDelay, wantErr: true},
+		{name: "unknown mode", mode: config.ThrottleMode("drop"), wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:             1,
+				M:             1,
+				Pd:            .1,
+				Pi:            .15,
+				ThrottleMode:  tc.mode,
+				MaxRetryAfter: tc.maxRetryAfter,
+			}
+
+			err := validateStructureConfig(conf)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRegisterRequest_ThrottleModes(t *testing.T) {
+	newThrottlingStructure := func(mode config.ThrottleMode) *Structure {
+		conf := &config.FairnessTrackerConfig{
+			L:             1,
+			M:             1,
+			Pd:            .1,
+			Pi:            .15,
+			ThrottleMode:  mode,
+			MaxRetryAfter: 4 * time.Second,
+			FinalProbabilityFunction: func(_ []float64) float64 {
+				return 1
+			},
+		}
+		structure, err := NewStructure(conf, 1, false)
+		require.NoError(t, err)
+		return structure
+	}
+	ctx := context.Background()
+	id := []byte("client")
+
+	t.Run("reject throttles without retry-after", func(t *testing.T) {
+		resp := newThrottlingStructure(config.ThrottleModeReject).RegisterRequest(ctx, id)
+
+		require.True(t, resp.ShouldThrottle)
+		require.Zero(t, resp.RetryAfter)
+		require.False(t, resp.ShadowThrottled)
+	})
+
+	t.Run("delay throttles with retry-after scaled by probability", func(t *testing.T) {
+		resp := newThrottlingStructure(config.ThrottleModeDelay).RegisterRequest(ctx, id)
+
+		require.True(t, resp.ShouldThrottle)
+		require.Equal(t, 4*time.Second, resp.RetryAfter)
+		require.False(t, resp.ShadowThrottled)
+	})
+
+	t.Run("shadow records but never throttles", func(t *testing.T) {
+		resp := newThrottlingStructure(config.ThrottleModeShadow).RegisterRequest(ctx, id)
+
+		require.False(t, resp.ShouldThrottle)
+		require.Zero(t, resp.RetryAfter)
+		require.True(t, resp.ShadowThrottled)
+	})
+}
+
+func TestRegisterRequest_DecisionModes(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mode             config.DecisionMode
+		threshold        float64
+		probability      float64
+		expectedThrottle bool
+	}{
+		{name: "probabilistic at 1 throttles", mode: config.DecisionModeProbabilistic, probability: 1, expectedThrottle: true},
+		{name: "unset mode is probabilistic", probability: 1, expectedThrottle: true},
+		{name: "threshold above", mode: config.DecisionModeThreshold, threshold: 0.5, probability: 0.6, expectedThrottle: true},
+		{name: "threshold at the threshold", mode: config.DecisionModeThreshold, threshold: 0.5, probability: 0.5},
+		{name: "threshold below", mode: config.DecisionModeThreshold, threshold: 0.5, probability: 0.4},
+		{name: "defer never throttles", mode: config.DecisionModeDefer, probability: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                 1,
+				M:                 1,
+				Pd:                .1,
+				Pi:                .15,
+				DecisionMode:      tc.mode,
+				DecisionThreshold: tc.threshold,
+				FinalProbabilityFunction: func(_ []float64) float64 {
+					return tc.probability
+				},
+			}
+			structure, err := NewStructure(conf, 1, false)
+			require.NoError(t, err)
+
+			resp := structure.RegisterRequest(context.Background(), []byte("client"))
+
+			require.Equal(t, tc.expectedThrottle, resp.ShouldThrottle)
+			require.Equal(t, tc.probability, resp.FinalProbability, "the probability should be set without stats")
+			require.Nil(t, resp.ResultStats)
+		})
+	}
+}
+
+func TestRegisterRequest_MinPassRate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mode        config.DecisionMode
+		minPassRate float64
+	}{
+		{name: "disabled", mode: config.DecisionModeProbabilistic},
+		{name: "probabilistic", mode: config.DecisionModeProbabilistic, minPassRate: 0.1},
+		{name: "threshold", mode: config.DecisionModeThreshold, minPassRate: 0.1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:            1,
+				M:            1,
+				Pd:           .1,
+				Pi:           .15,
+				DecisionMode: tc.mode,
+				MinPassRate:  tc.minPassRate,
+				FinalProbabilityFunction: func(_ []float64) float64 {
+					return 1
+				},
+			}
+			structure, err := NewStructure(conf, 1, false)
+			require.NoError(t, err)
+
+			const n = 10000
+			passed := 0
+			for range n {
+				if !structure.RegisterRequest(context.Background(), []byte("client")).ShouldThrottle {
+					passed++
+				}
+			}
+
+			require.InDelta(t, tc.minPassRate, float64(passed)/n, 0.02)
+		})
+	}
+}
+
+func TestValidateStructConfig_MinPassRate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		minPassRate float64
+		wantErr     bool
+	}{
+		{name: "disabled", minPassRate: 0},
+		{name: "small", minPassRate: 0.01},
+		{name: "negative", minPassRate: -0.01, wantErr: true},
+		{name: "1 never throttles", minPassRate: 1, wantErr: true},
+		{name: "NaN", minPassRate: math.NaN(), wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:           1,
+				M:           1,
+				Pd:          .1,
+				Pi:          .15,
+				MinPassRate: tc.minPassRate,
+			}
+
+			err := validateStructureConfig(conf)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateStructConfig_DecisionMode(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mode      config.DecisionMode
+		threshold float64
+		wantErr   bool
+	}{
+		{name: "unset mode defaults to probabilistic", mode: ""},
+		{name: "probabilistic", mode: config.DecisionModeProbabilistic},
+		{name: "defer", mode: config.DecisionModeDefer},
+		{name: "threshold", mode: config.DecisionModeThreshold, threshold: 0.5},
+		{name: "threshold of 0", mode: config.DecisionModeThreshold, threshold: 0},
+		{name: "threshold above 1", mode: config.DecisionModeThreshold, threshold: 1.5, wantErr: true},
+		{name: "negative threshold", mode: config.DecisionModeThreshold, threshold: -0.1, wantErr: true},
+		{name: "NaN threshold", mode: config.DecisionModeThreshold, threshold: math.NaN(), wantErr: true},
+		{name: "unknown mode", mode: config.DecisionMode("random"), wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                 1,
+				M:                 1,
+				Pd:                .1,
+				Pi:                .15,
+				DecisionMode:      tc.mode,
+				DecisionThreshold: tc.threshold,
+			}
+
+			err := validateStructureConfig(conf)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRegisterRequest_ContextDone(t *testing.T) {
+	conf := &config.FairnessTrackerConfig{
+		L:  1,
+		M:  1,
+		Pd: .1,
+		Pi: .15,
+		FinalProbabilityFunction: func(_ []float64) float64 {
+			return 1
+		},
+	}
+	structure, err := NewStructure(conf, 1, false)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp := structure.RegisterRequest(ctx, []byte("client"))
+
+	require.ErrorIs(t, resp.Err, context.Canceled)
+	require.False(t, resp.ShouldThrottle)
+}
+
+func TestReportOutcomeWithCost(t *testing.T) {
+	testCases := []struct {
+		name         string
+		outcome      request.Outcome
+		cost         float64
+		initialProb  float64
+		expectedProb float64
+	}{
+		{name: "failure cost scales Pi", outcome: request.OutcomeFailure, cost: 3, initialProb: 0.1, expectedProb: 0.4},
+		{name: "success cost scales Pd", outcome: request.OutcomeSuccess, cost: 2, initialProb: 0.5, expectedProb: 0.3},
+		{name: "fractional cost", outcome: request.OutcomeFailure, cost: 0.5, initialProb: 0, expectedProb: 0.05},
+		{name: "zero cost is a no-op", outcome: request.OutcomeFailure, cost: 0, initialProb: 0.2, expectedProb: 0.2},
+		{name: "negative cost is a no-op", outcome: request.OutcomeFailure, cost: -1, initialProb: 0.2, expectedProb: 0.2},
+		{name: "large cost clamps at 1", outcome: request.OutcomeFailure, cost: 100, initialProb: 0, expectedProb: 1},
+		{name: "NaN cost is a no-op", outcome: request.OutcomeFailure, cost: math.NaN(), initialProb: 0.2, expectedProb: 0.2},
+		{name: "infinite cost clamps at 1", outcome: request.OutcomeFailure, cost: math.Inf(1), initialProb: 0.2, expectedProb: 1},
+		{name: "infinite success cost clamps at 0", outcome: request.OutcomeSuccess, cost: math.Inf(1), initialProb: 0.2, expectedProb: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:  1,
+				M:  1,
+				Pi: 0.1,
+				Pd: 0.1 - 1e-12,
+			}
+			structure, err := NewStructure(conf, 1, false)
+			require.NoError(t, err)
+			clientID := []byte("client")
+			structure.visitBuckets(clientID, func(_, _ uint32, b *bucket) {
+				b.probability = tc.initialProb
+			})
+
+			structure.ReportOutcomeWithCost(context.Background(), clientID, tc.outcome, tc.cost)
+
+			structure.visitBuckets(clientID, func(_, _ uint32, b *bucket) {
+				require.InDelta(t, tc.expectedProb, b.probability, 1e-9)
+			})
+		})
+	}
+}
+
+func TestDecayFunction_OutOfRange(t *testing.T) {
+	for name, decayed := range map[string]float64{"NaN": math.NaN(), "above 1": 2, "below 0": -1, "infinite": math.Inf(1)} {
+		t.Run(name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                        1,
+				M:                        1,
+				Pi:                       0.5,
+				Pd:                       0.1,
+				FinalProbabilityFunction: config.MinFinalProbabilityFunction,
+				DecayFunction: func(_, _ float64, _ time.Duration) float64 {
+					return decayed
+				},
+			}
+			structure, err := NewStructure(conf, 1, false)
+			require.NoError(t, err)
+			ctx := context.Background()
+			clientID := []byte("client")
+
+			structure.ReportOutcome(ctx, clientID, request.OutcomeFailure)
+			p := structure.RegisterRequest(ctx, clientID).FinalProbability
+
+			require.GreaterOrEqual(t, p, 0.0)
+			require.LessOrEqual(t, p, 1.0)
+		})
+	}
+}
+
+func TestReportOutcome_OutcomeMultipliers(t *testing.T) {
+	testCases := []struct {
+		name         string
+		outcome      request.Outcome
+		multipliers  map[request.Outcome]float64
+		expectedProb float64
+	}{
+		{name: "failure defaults to Pi", outcome: request.OutcomeFailure, expectedProb: 0.1},
+		{name: "timeout defaults to Pi", outcome: request.OutcomeTimeout, expectedProb: 0.1},
+		{name: "rejection defaults to Pi", outcome: request.OutcomeRejected, expectedProb: 0.1},
+		{name: "client error is ignored by default", outcome: request.OutcomeClientError, expectedProb: 0},
+		{name: "unknown outcome counts as failure", outcome: request.Outcome(100), expectedProb: 0.1},
+		{
+			name:         "timeout override",
+			outcome:      request.OutcomeTimeout,
+			multipliers:  map[request.Outcome]float64{request.OutcomeTimeout: 2},
+			expectedProb: 0.2,
+		},
+		{
+			name:         "client error override",
+			outcome:      request.OutcomeClientError,
+			multipliers:  map[request.Outcome]float64{request.OutcomeClientError: 0.5},
+			expectedProb: 0.05,
+		},
+		{
+			name:         "failure override to zero",
+			outcome:      request.OutcomeFailure,
+			multipliers:  map[request.Outcome]float64{request.OutcomeFailure: 0},
+			expectedProb: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                  1,
+				M:                  1,
+				Pi:                 0.1,
+				Pd:                 0.01,
+				OutcomeMultipliers: tc.multipliers,
+			}
+			structure, err := NewStructure(conf, 1, false)
+			require.NoError(t, err)
+			clientID := []byte("client")
+
+			structure.ReportOutcome(context.Background(), clientID, tc.outcome)
+
+			structure.visitBuckets(clientID, func(_, _ uint32, b *bucket) {
+				require.InDelta(t, tc.expectedProb, b.probability, 1e-9)
+			})
+		})
+	}
+}
+
+func TestValidateStructConfig_OutcomeMultipliers(t *testing.T) {
+	testCases := []struct {
+		name        string
+		multipliers map[request.Outcome]float64
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "valid overrides", multipliers: map[request.Outcome]float64{request.OutcomeTimeout: 2, request.OutcomeClientError: 0}},
+		{name: "success", multipliers: map[request.Outcome]float64{request.OutcomeSuccess: 1}, wantErr: true},
+		{name: "unknown outcome", multipliers: map[request.Outcome]float64{request.Outcome(100): 1}, wantErr: true},
+		{name: "negative", multipliers: map[request.Outcome]float64{request.OutcomeTimeout: -1}, wantErr: true},
+		{name: "NaN", multipliers: map[request.Outcome]float64{request.OutcomeTimeout: math.NaN()}, wantErr: true},
+		{name: "infinite", multipliers: map[request.Outcome]float64{request.OutcomeTimeout: math.Inf(1)}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                  1,
+				M:                  1,
+				Pd:                 .1,
+				Pi:                 .15,
+				OutcomeMultipliers: tc.multipliers,
+			}
+
+			err := validateStructureConfig(conf)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateStructConfig_PriorityMultipliers(t *testing.T) {
+	testCases := []struct {
+		name        string
+		multipliers map[request.Priority]float64
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "valid overrides", multipliers: map[request.Priority]float64{request.PriorityHigh: 0, request.PriorityLow: 2}},
+		{name: "unknown priority", multipliers: map[request.Priority]float64{request.Priority(100): 1}, wantErr: true},
+		{name: "negative", multipliers: map[request.Priority]float64{request.PriorityLow: -1}, wantErr: true},
+		{name: "NaN", multipliers: map[request.Priority]float64{request.PriorityLow: math.NaN()}, wantErr: true},
+		{name: "infinite", multipliers: map[request.Priority]float64{request.PriorityLow: math.Inf(1)}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.FairnessTrackerConfig{
+				L:                   1,
+				M:                   1,
+				Pd:                  .1,
+				Pi:                  .15,
+				PriorityMultipliers: tc.multipliers,
+			}
+
+			err := validateStructureConfig(conf)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func newBenchmarkStructure(b *testing.B) *Structure {
+	b.Helper()
+
+	conf, err := config.GenerateTunedStructureConfig(1000, 1000, 25)
+	if err != nil {
+		b.Fatal(err)
+	}
+	structure, err := NewStructure(conf, 1, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return structure
+}
+
+// Run the given operation from the given number of goroutines, each cycling
+// through its own set of client identifiers
+func runParallel(b *testing.B, goroutines int, fn func(clientIdentifier []byte)) {
+	b.Helper()
+
+	var worker atomic.Int64
+	b.SetParallelism(goroutines)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		w := worker.Add(1)
+		ids := make([][]byte, 64)
+		for i := range ids {
+			ids[i] = []byte(fmt.Sprintf("client-%d-%d", w, i))
+		}
+
+		i := 0
+		for pb.Next() {
+			fn(ids[i%len(ids)])
+			i++
+		}
+	})
+}
+
+// Benchmarks throughput under contention. Every bucket has its own lock, so
+// goroutines only contend when their clients hash into the same bucket. Run
+// with -cpu to vary GOMAXPROCS; the parallelism multiplies it.
+func BenchmarkStructureContention(b *testing.B) {
+	ctx := context.Background()
+
+	for _, goroutines := range []int{1, 8, 64, 256} {
+		b.Run(fmt.Sprintf("RegisterRequest/parallelism=%d", goroutines), func(b *testing.B) {
+			structure := newBenchmarkStructure(b)
+			runParallel(b, goroutines, func(id []byte) {
+				structure.RegisterRequest(ctx, id)
+			})
+		})
+
+		b.Run(fmt.Sprintf("ReportOutcome/parallelism=%d", goroutines), func(b *testing.B) {
+			structure := newBenchmarkStructure(b)
+			runParallel(b, goroutines, func(id []byte) {
+				structure.ReportOutcome(ctx, id, request.OutcomeFailure)
+			})
+		})
+	}
+}
+
+// Benchmarks the worst case where every goroutine reports for the same client
+// and therefore contends on the same L buckets
+func BenchmarkStructureHotClient(b *testing.B) {
+	ctx := context.Background()
+	id := []byte("hot-client")
+
+	for _, goroutines := range []int{1, 64} {
+		b.Run(fmt.Sprintf("parallelism=%d", goroutines), func(b *testing.B) {
+			structure := newBenchmarkStructure(b)
+			b.SetParallelism(goroutines)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					structure.ReportOutcome(ctx, id, request.OutcomeFailure)
+				}
+			})
+		})
+	}
+}
+
+// Benchmarks allocations on the single-request paths. RegisterRequestInto and
+// ReportOutcome should not allocate when stats are disabled.
+func BenchmarkStructureAllocs(b *testing.B) {
+	ctx := context.Background()
+	id := []byte("client")
+
+	b.Run("RegisterRequest", func(b *testing.B) {
+		structure := newBenchmarkStructure(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			structure.RegisterRequest(ctx, id)
+		}
+	})
+
+	b.Run("RegisterRequestInto", func(b *testing.B) {
+		structure := newBenchmarkStructure(b)
+		result := &request.RegisterRequestResult{}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			structure.RegisterRequestInto(ctx, id, result)
+		}
+	})
+
+	b.Run("ReportOutcome", func(b *testing.B) {
+		structure := newBenchmarkStructure(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			structure.ReportOutcome(ctx, id, request.OutcomeFailure)
+		}
+	})
+}
+
+func TestDecideWithDraws(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.MinPassRate = 0.5
+
+	testCases := []struct {
+		name     string
+		draws    Draws
+		throttle bool
+	}{
+		{name: "draw below the probability", draws: Draws{Throttle: 0.2, Pass: 0.9}, throttle: true},
+		{name: "draw above the probability", draws: Draws{Throttle: 0.8, Pass: 0.9}},
+		{name: "let through by the pass rate", draws: Draws{Throttle: 0.2, Pass: 0.1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := &request.RegisterRequestResult{}
+
+			DecideWithDraws(conf, 0.6, tc.draws, result)
+
+			assert.Equal(t, tc.throttle, result.ShouldThrottle)
+			assert.Equal(t, 0.6, result.FinalProbability)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// HeavyHitter is a key reported by HeavyHitters along with its estimated count.
+type HeavyHitter struct {
+	// The key that was counted
+	Key []byte
+	// The estimated number of times the key was seen. It never underestimates
+	// the true count.
+	Count uint64
+	// The maximum amount by which Count may overestimate the true count
+	Error uint64
+}
+
+// HeavyHitters is a space-efficient sketch that tracks the most frequent keys
+// in a stream using the Space-Saving algorithm:
+// https://www.cs.ucsb.edu/sites/default/files/documents/2005-23.pdf
+//
+// Memory is bounded by the capacity regardless of how many distinct keys are
+// seen. Any key seen more than N/capacity times out of N is guaranteed to be
+// tracked. It is safe for concurrent use.
+type HeavyHitters struct {
+	capacity int
+	entries  map[string]*heavyHitterEntry
+	minHeap  heavyHitterHeap
+	mu       sync.Mutex
+}
+
+type heavyHitterEntry struct {
+	key   string
+	count uint64
+	err   uint64
+	index int
+}
+
+// NewHeavyHitters creates a sketch that tracks at most capacity keys.
+func NewHeavyHitters(capacity int) *HeavyHitters {
+	return &HeavyHitters{
+		capacity: capacity,
+		entries:  make(map[string]*heavyHitterEntry, capacity),
+		minHeap:  make(heavyHitterHeap, 0, capacity),
+	}
+}
+
+// Add records one occurrence of the given key.
+func (hh *HeavyHitters) Add(key []byte) {
+	if hh.capacity <= 0 {
+		return
+	}
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if e, ok := hh.entries[string(key)]; ok {
+		e.count++
+		heap.Fix(&hh.minHeap, e.index)
+		return
+	}
+
+	if len(hh.minHeap) < hh.capacity {
+		e := &heavyHitterEntry{key: string(key), count: 1}
+		hh.entries[e.key] = e
+		heap.Push(&hh.minHeap, e)
+		return
+	}
+
+	// Evict the smallest counter and let the new key inherit its count
+	evicted := hh.minHeap[0]
+	delete(hh.entries, evicted.key)
+
+	evicted.key = string(key)
+	evicted.err = evicted.count
+	evicted.count++
+	hh.entries[evicted.key] = evicted
+	heap.Fix(&hh.minHeap, 0)
+}
+
+// Top returns up to k tracked keys ordered by descending count.
+func (hh *HeavyHitters) Top(k int) []HeavyHitter {
+	if k <= 0 {
+		return nil
+	}
+
+	hh.mu.Lock()
+	result := make([]HeavyHitter, 0, len(hh.minHeap))
+	for _, e := range hh.minHeap {
+		result = append(result, HeavyHitter{
+			Key:   []byte(e.key),
+			Count: e.count,
+			Error: e.err,
+		})
+	}
+	hh.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return string(result[i].Key) < string(result[j].Key)
+	})
+
+	if k < len(result) {
+		result = result[:k]
+	}
+	return result
+}
+
+// A min-heap of entries ordered by count so the eviction candidate is always
+// at the root
+type heavyHitterHeap []*heavyHitterEntry
+
+func (h heavyHitterHeap) Len() int           { return len(h) }
+func (h heavyHitterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h heavyHitterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *heavyHitterHeap) Push(x any) {
+	e := x.(*heavyHitterEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *heavyHitterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeavyHitters_ExactBelowCapacity(t *testing.T) {
+	hh := NewHeavyHitters(3)
+
+	for i := 0; i < 5; i++ {
+		hh.Add([]byte("a"))
+	}
+	for i := 0; i < 3; i++ {
+		hh.Add([]byte("b"))
+	}
+	hh.Add([]byte("c"))
+
+	top := hh.Top(10)
+	require.Equal(t, []HeavyHitter{
+		{Key: []byte("a"), Count: 5},
+		{Key: []byte("b"), Count: 3},
+		{Key: []byte("c"), Count: 1},
+	}, top)
+}
+
+func TestHeavyHitters_TopLimitsResults(t *testing.T) {
+	hh := NewHeavyHitters(3)
+	hh.Add([]byte("a"))
+	hh.Add([]byte("a"))
+	hh.Add([]byte("b"))
+
+	top := hh.Top(1)
+
+	require.Len(t, top, 1)
+	require.Equal(t, []byte("a"), top[0].Key)
+	require.Empty(t, hh.Top(0))
+}
+
+func TestHeavyHitters_EvictsSmallestAndTracksError(t *testing.T) {
+	hh := NewHeavyHitters(2)
+	hh.Add([]byte("a"))
+	hh.Add([]byte("a"))
+	hh.Add([]byte("b"))
+
+	hh.Add([]byte("c"))
+
+	top := hh.Top(2)
+	require.Equal(t, []HeavyHitter{
+		{Key: []byte("a"), Count: 2},
+		{Key: []byte("c"), Count: 2, Error: 1},
+	}, top)
+}
+
+func TestHeavyHitters_FindsFrequentKeyAmongNoise(t *testing.T) {
+	hh := NewHeavyHitters(10)
+
+	for i := 0; i < 1000; i++ {
+		hh.Add([]byte(fmt.Sprintf("noise-%d", i)))
+		if i%4 == 0 {
+			hh.Add([]byte("offender"))
+		}
+	}
+
+	top := hh.Top(1)
+	require.Equal(t, []byte("offender"), top[0].Key)
+	require.GreaterOrEqual(t, top[0].Count, uint64(250))
+}
+
+func TestHeavyHitters_ZeroCapacityIsDisabled(t *testing.T) {
+	hh := NewHeavyHitters(0)
+
+	hh.Add([]byte("a"))
+
+	require.Empty(t, hh.Top(1))
+}
+
+func TestHeavyHitters_Concurrent(t *testing.T) {
+	hh := NewHeavyHitters(4)
+	var wg sync.WaitGroup
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				hh.Add([]byte("a"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, []HeavyHitter{{Key: []byte("a"), Count: 800}}, hh.Top(1))
+}
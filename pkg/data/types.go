@@ -17,3 +17,10 @@ func NewDataError(wrapped error, msg string, args ...any) *DataError {
 		BaseError: utils.NewBaseError(wrapped, msg, args...),
 	}
 }
+
+// WithSentinel marks the error as an instance of the given sentinel from the
+// fairerrors package so that errors.Is matches it.
+func (e *DataError) WithSentinel(sentinel error) *DataError {
+	e.BaseError.WithSentinel(sentinel)
+	return e
+}
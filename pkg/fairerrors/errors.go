@@ -0,0 +1,26 @@
+// Package fairerrors defines sentinel errors shared across the library. Errors
+// returned by the library match them with errors.Is, so callers can branch on
+// the kind of failure without parsing messages.
+package fairerrors
+
+import "errors"
+
+var (
+	// ErrNilConfig is matched by errors returned when a required config is nil.
+	ErrNilConfig = errors.New("nil config")
+
+	// ErrInvalidConfig is matched by errors returned when a config fails
+	// validation.
+	ErrInvalidConfig = errors.New("invalid config")
+
+	// ErrStructureCreation is matched by errors returned when the tracker fails
+	// to create one of its underlying structures.
+	ErrStructureCreation = errors.New("failed to create a structure")
+
+	// ErrClosed is returned by tracker operations after the tracker is closed.
+	ErrClosed = errors.New("tracker is closed")
+
+	// ErrUnknownToken is returned when reporting the outcome of a token that
+	// was never issued, already reported or already timed out.
+	ErrUnknownToken = errors.New("unknown token")
+)
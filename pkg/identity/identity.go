@@ -0,0 +1,159 @@
+// Package identity provides ready-made extractors that derive client
+// identifiers from HTTP requests.
+package identity
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// FromHeader uses the value of the given header as the identity.
+func FromHeader(name string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		value := r.Header.Get(name)
+		if value == "" {
+			return nil, NewIdentityError(ErrNoIdentity, "header %q is not set", name)
+		}
+		return []byte(value), nil
+	}
+}
+
+// FromCookie uses the value of the given cookie as the identity.
+func FromCookie(name string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return nil, NewIdentityError(ErrNoIdentity, "cookie %q is not set", name)
+		}
+		return []byte(cookie.Value), nil
+	}
+}
+
+// FromJWTClaim uses a claim of the bearer token in the Authorization header as
+// the identity, for example "sub" or "tenant". String and numeric claims are
+// supported. The token signature is NOT verified, so the token must already
+// have been authenticated before the request reaches the extractor.
+func FromJWTClaim(claim string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return nil, NewIdentityError(ErrNoIdentity, "no bearer token in the Authorization header")
+		}
+
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return nil, NewIdentityError(nil, "malformed JWT: expected 3 parts, found %d", len(parts))
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, NewIdentityError(err, "malformed JWT payload")
+		}
+
+		var claims map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&claims); err != nil {
+			return nil, NewIdentityError(err, "malformed JWT claims")
+		}
+
+		switch value := claims[claim].(type) {
+		case string:
+			if value != "" {
+				return []byte(value), nil
+			}
+		case json.Number:
+			return []byte(value.String()), nil
+		case nil:
+		default:
+			return nil, NewIdentityError(nil, "JWT claim %q has unsupported type %T", claim, value)
+		}
+		return nil, NewIdentityError(ErrNoIdentity, "JWT claim %q is not set", claim)
+	}
+}
+
+// FromClientCert uses the subject common name of the verified TLS client
+// certificate as the identity.
+func FromClientCert() Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return nil, NewIdentityError(ErrNoIdentity, "no TLS client certificate")
+		}
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		if commonName == "" {
+			return nil, NewIdentityError(ErrNoIdentity, "TLS client certificate has no common name")
+		}
+		return []byte(commonName), nil
+	}
+}
+
+// FromIP uses the remote address of the request as the identity, aggregated
+// into CIDR prefixes of the given lengths so that clients spreading requests
+// across a range of addresses are tracked as one flow. For example, prefix
+// lengths of 24 and 64 track IPv4 clients per /24 and IPv6 clients per /64.
+// Pass 32 and 128 to track individual addresses. Only the connection address
+// is used; forwarding headers set by proxies are ignored since clients can
+// forge them.
+func FromIP(ipv4PrefixLen, ipv6PrefixLen int) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		return IPPrefix(r.RemoteAddr, ipv4PrefixLen, ipv6PrefixLen)
+	}
+}
+
+// IPPrefix returns the identity FromIP extracts for the given address, for
+// callers that don't serve HTTP such as gRPC servers or raw listeners. The
+// address may carry a port. The identity is the canonical text form of the
+// prefix, such as "192.0.2.0/24", so it hashes to the same buckets across
+// processes and restarts.
+func IPPrefix(address string, ipv4PrefixLen, ipv6PrefixLen int) ([]byte, error) {
+	addr, err := remoteAddr(address)
+	if err != nil {
+		return nil, NewIdentityError(err, "invalid remote address %q", address)
+	}
+
+	prefixLen := ipv6PrefixLen
+	if addr.Is4() {
+		prefixLen = ipv4PrefixLen
+	}
+	prefix, err := addr.Prefix(prefixLen)
+	if err != nil {
+		return nil, NewIdentityError(err, "invalid prefix length %d for %s", prefixLen, addr)
+	}
+	return []byte(prefix.String()), nil
+}
+
+// FirstOf returns an extractor that tries the given extractors in order and
+// uses the first identity found. Errors other than ErrNoIdentity are returned
+// immediately.
+func FirstOf(extractors ...Extractor) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		for _, extract := range extractors {
+			id, err := extract(r)
+			if err == nil {
+				return id, nil
+			}
+			if !errors.Is(err, ErrNoIdentity) {
+				return nil, err
+			}
+		}
+		return nil, NewIdentityError(ErrNoIdentity, "none of the %d extractors found an identity", len(extractors))
+	}
+}
+
+// Parse a remote address with or without a port, unmapping IPv4-mapped IPv6
+// addresses so they aggregate with their IPv4 prefixes
+func remoteAddr(remote string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(remote); err == nil {
+		return addrPort.Addr().Unmap().WithZone(""), nil
+	}
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("not an IP address: %w", err)
+	}
+	return addr.Unmap().WithZone(""), nil
+}
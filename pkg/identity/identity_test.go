@@ -0,0 +1,222 @@
+package identity
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config/hashers"
+)
+
+// Build an unsigned JWT with the given JSON claims
+func jwtWithClaims(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return header + "." + payload + ".signature"
+}
+
+func TestFromHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Client-ID", "client-1")
+
+	id, err := FromHeader("X-Client-ID")(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("client-1"), id)
+
+	_, err = FromHeader("X-Tenant")(r)
+	assert.ErrorIs(t, err, ErrNoIdentity)
+}
+
+func TestFromCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	id, err := FromCookie("session")(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abc"), id)
+
+	_, err = FromCookie("missing")(r)
+	assert.ErrorIs(t, err, ErrNoIdentity)
+}
+
+func TestFromJWTClaim(t *testing.T) {
+	testCases := []struct {
+		name          string
+		authorization string
+		claim         string
+		expectedID    []byte
+		noIdentity    bool
+		wantErr       bool
+	}{
+		{name: "subject", authorization: "Bearer " + jwtWithClaims(`{"sub":"user-1","tenant":"acme"}`), claim: "sub", expectedID: []byte("user-1")},
+		{name: "tenant", authorization: "Bearer " + jwtWithClaims(`{"sub":"user-1","tenant":"acme"}`), claim: "tenant", expectedID: []byte("acme")},
+		{name: "numeric claim", authorization: "Bearer " + jwtWithClaims(`{"sub":12345678901234567890}`), claim: "sub", expectedID: []byte("12345678901234567890")},
+		{name: "missing claim", authorization: "Bearer " + jwtWithClaims(`{"sub":"user-1"}`), claim: "tenant", noIdentity: true},
+		{name: "empty claim", authorization: "Bearer " + jwtWithClaims(`{"sub":""}`), claim: "sub", noIdentity: true},
+		{name: "no header", claim: "sub", noIdentity: true},
+		{name: "not a bearer token", authorization: "Basic dXNlcjpwYXNz", claim: "sub", noIdentity: true},
+		{name: "malformed token", authorization: "Bearer abc", claim: "sub", wantErr: true},
+		{name: "malformed payload", authorization: "Bearer a.!!!.c", claim: "sub", wantErr: true},
+		{name: "unsupported claim type", authorization: "Bearer " + jwtWithClaims(`{"sub":["a"]}`), claim: "sub", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+
+			id, err := FromJWTClaim(tc.claim)(r)
+
+			switch {
+			case tc.noIdentity:
+				assert.ErrorIs(t, err, ErrNoIdentity)
+			case tc.wantErr:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, ErrNoIdentity)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedID, id)
+			}
+		})
+	}
+}
+
+func TestFromClientCert(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := FromClientCert()(r)
+	assert.ErrorIs(t, err, ErrNoIdentity)
+
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "service-a"}}},
+	}
+	id, err := FromClientCert()(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("service-a"), id)
+}
+
+func TestFromIP(t *testing.T) {
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		expectedID string
+		wantErr    bool
+	}{
+		{name: "IPv4 with port", remoteAddr: "192.0.2.57:1234", expectedID: "192.0.2.0/24"},
+		{name: "IPv4 without port", remoteAddr: "192.0.2.57", expectedID: "192.0.2.0/24"},
+		{name: "IPv6", remoteAddr: "[2001:db8:1:2:3:4:5:6]:443", expectedID: "2001:db8:1:2::/64"},
+		{name: "IPv4-mapped IPv6", remoteAddr: "[::ffff:192.0.2.57]:443", expectedID: "192.0.2.0/24"},
+		{name: "invalid address", remoteAddr: "not-an-ip", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+
+			id, err := FromIP(24, 64)(r)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedID, string(id))
+			}
+		})
+	}
+}
+
+func TestFromIP_InvalidPrefixLength(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.57:1234"
+
+	_, err := FromIP(33, 64)(r)
+
+	require.Error(t, err)
+}
+
+func TestIPPrefix(t *testing.T) {
+	testCases := []struct {
+		name       string
+		addresses  []string
+		expectedID string
+		// Murmur3 hash of the identity with seed 7. Pinned so the buckets of an
+		// IP range don't move across restarts or releases.
+		expectedH1 uint64
+		expectedH2 uint64
+	}{
+		{
+			name:       "adjacent IPv4 addresses",
+			addresses:  []string{"198.51.100.1", "198.51.100.254:8080", "[::ffff:198.51.100.7]:443"},
+			expectedID: "198.51.100.0/24",
+			expectedH1: 0xa01cf8642c30fc72,
+			expectedH2: 0xaab91fd2dbc8fd51,
+		},
+		{
+			name:       "adjacent IPv6 addresses",
+			addresses:  []string{"2001:db8:1:2::1", "[2001:db8:1:2:ffff::9]:443"},
+			expectedID: "2001:db8:1:2::/64",
+			expectedH1: 0x524bc16e6ed0a50b,
+			expectedH2: 0x5d2cb47674369c21,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, address := range tc.addresses {
+				id, err := IPPrefix(address, 24, 64)
+
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedID, string(id), "address %s", address)
+				h1, h2 := hashers.Murmur3(id, 7)
+				assert.Equal(t, tc.expectedH1, h1)
+				assert.Equal(t, tc.expectedH2, h2)
+			}
+		})
+	}
+}
+
+func TestIPPrefix_Errors(t *testing.T) {
+	_, err := IPPrefix("not-an-ip", 24, 64)
+	require.Error(t, err)
+
+	_, err = IPPrefix("2001:db8::1", 24, 129)
+	require.Error(t, err)
+}
+
+func TestFirstOf(t *testing.T) {
+	extract := FirstOf(FromHeader("X-Client-ID"), FromIP(32, 128))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.57:1234"
+
+	id, err := extract(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("192.0.2.57/32"), id)
+
+	r.Header.Set("X-Client-ID", "client-1")
+	id, err = extract(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("client-1"), id)
+
+	_, err = FirstOf(FromHeader("X-Tenant"))(r)
+	assert.ErrorIs(t, err, ErrNoIdentity)
+}
+
+func TestFirstOf_StopsOnError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer malformed")
+	r.Header.Set("X-Client-ID", "client-1")
+
+	_, err := FirstOf(FromJWTClaim("sub"), FromHeader("X-Client-ID"))(r)
+
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoIdentity)
+}
@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer rewrites a client identifier before it is tracked, so variants of
+// the same identity such as "ClientA" and "clienta " map to the same flow. It
+// must not modify the given identifier in place, and must be safe for
+// concurrent use. Set it as IdentifierNormalizer in the tracker config.
+type Normalizer func(clientIdentifier []byte) []byte
+
+// Chain returns a normalizer that applies the given normalizers in order. A
+// typical chain trims and canonicalizes first and hashes last:
+//
+//	identity.Chain(identity.TrimSpace(), identity.NFC(), identity.Lowercase(), identity.HMAC(secret))
+func Chain(normalizers ...Normalizer) Normalizer {
+	return func(clientIdentifier []byte) []byte {
+		for _, normalize := range normalizers {
+			clientIdentifier = normalize(clientIdentifier)
+		}
+		return clientIdentifier
+	}
+}
+
+// Lowercase maps Unicode letters to their lower case.
+func Lowercase() Normalizer {
+	return bytes.ToLower
+}
+
+// TrimSpace removes leading and trailing Unicode white space.
+func TrimSpace() Normalizer {
+	return bytes.TrimSpace
+}
+
+// NFC converts identifiers to the Unicode normalization form C, so composed
+// and decomposed spellings of the same characters are tracked as one flow.
+func NFC() Normalizer {
+	return norm.NFC.Bytes
+}
+
+// MaxLength truncates identifiers to at most maxBytes bytes without splitting
+// a UTF-8 encoded character. It bounds the memory used by clients sending
+// huge identifiers, at the cost of merging identifiers sharing a long prefix.
+func MaxLength(maxBytes int) Normalizer {
+	return func(clientIdentifier []byte) []byte {
+		if len(clientIdentifier) <= maxBytes {
+			return clientIdentifier
+		}
+
+		end := max(maxBytes, 0)
+		// Back off to the start of the character that doesn't fit
+		for end > 0 && !utf8.RuneStart(clientIdentifier[end]) {
+			end--
+		}
+		return clientIdentifier[:end]
+	}
+}
+
+// HMAC replaces identifiers with the hex-encoded HMAC-SHA256 of the given
+// secret, so raw identifiers such as emails or IP addresses never reach the
+// structures, observers or logs, while the same identifier keeps mapping to
+// the same flow. Use the same secret everywhere decisions must agree, and
+// apply it last in a chain since it destroys the structure of the input.
+func HMAC(secret []byte) Normalizer {
+	key := bytes.Clone(secret)
+	macs := sync.Pool{
+		New: func() any {
+			return hmac.New(sha256.New, key)
+		},
+	}
+
+	return func(clientIdentifier []byte) []byte {
+		mac := macs.Get().(hash.Hash)
+		defer macs.Put(mac)
+
+		mac.Reset()
+		mac.Write(clientIdentifier)
+		var sum [sha256.Size]byte
+		return hex.AppendEncode(nil, mac.Sum(sum[:0]))
+	}
+}
@@ -0,0 +1,50 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		normalizer Normalizer
+		input      string
+		expected   string
+	}{
+		{name: "lowercase", normalizer: Lowercase(), input: "ClientÄ", expected: "clientä"},
+		{name: "trim", normalizer: TrimSpace(), input: " \tclient\n", expected: "client"},
+		{name: "NFC", normalizer: NFC(), input: "café", expected: "café"},
+		{name: "max length fits", normalizer: MaxLength(6), input: "client", expected: "client"},
+		{name: "max length truncates", normalizer: MaxLength(3), input: "client", expected: "cli"},
+		{name: "max length keeps characters whole", normalizer: MaxLength(4), input: "café", expected: "caf"},
+		{name: "max length zero", normalizer: MaxLength(0), input: "client", expected: ""},
+		{name: "chain", normalizer: Chain(TrimSpace(), Lowercase(), MaxLength(7)), input: "  ClientA  ", expected: "clienta"},
+		{name: "empty chain", normalizer: Chain(), input: "ClientA", expected: "ClientA"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := []byte(tc.input)
+
+			assert.Equal(t, tc.expected, string(tc.normalizer(input)))
+			assert.Equal(t, tc.input, string(input), "the input must not be modified")
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	normalize := HMAC([]byte("secret"))
+
+	id := normalize([]byte("user@example.com"))
+
+	assert.Len(t, id, 64)
+	assert.NotContains(t, string(id), "example")
+	assert.Equal(t, id, normalize([]byte("user@example.com")), "the same identifier maps to the same flow")
+	assert.NotEqual(t, id, normalize([]byte("other@example.com")))
+	assert.NotEqual(t, id, HMAC([]byte("other-secret"))([]byte("user@example.com")))
+
+	chained := Chain(TrimSpace(), Lowercase(), normalize)
+	assert.Equal(t, chained([]byte("ClientA")), chained([]byte("clienta ")))
+}
@@ -0,0 +1,31 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// ErrNoIdentity is wrapped by the errors returned when a request does not
+// carry the identity an extractor looks for. Check for it with errors.Is to
+// fall back to another extractor or a default identity.
+var ErrNoIdentity = errors.New("no identity found in the request")
+
+// Extractor derives a client identifier suitable for RegisterRequest from an
+// HTTP request.
+type Extractor func(r *http.Request) ([]byte, error)
+
+// IdentityError is returned when an identity cannot be extracted from a
+// request.
+type IdentityError struct {
+	*utils.BaseError
+}
+
+// NewIdentityError wraps the given error with additional context for
+// extraction issues.
+func NewIdentityError(wrapped error, msg string, args ...any) *IdentityError {
+	return &IdentityError{
+		BaseError: utils.NewBaseError(wrapped, msg, args...),
+	}
+}
@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/data"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// TestGenerateTunedConfig_FalsePositiveRate simulates the population the tuned
+// config was derived for and checks that well-behaved clients are throttled
+// at no more than the tolerable false positive rate.
+func TestGenerateTunedConfig_FalsePositiveRate(t *testing.T) {
+	// Fix the structure's hash seed so the simulation is reproducible
+	//nolint:staticcheck // Using deprecated rand.Seed for deterministic test behavior
+	rand.Seed(1)
+	//nolint:staticcheck
+	defer rand.Seed(time.Now().UnixNano())
+
+	const (
+		expectedClients = 100_000
+		fpRate          = 0.01
+		badClients      = expectedClients / 1000
+		innocentClients = 20_000
+	)
+
+	conf, err := config.GenerateTunedConfig(expectedClients, fpRate, time.Hour)
+	require.NoError(t, err)
+	structure, err := data.NewStructure(conf, 1, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Fully block every bad client
+	for i := 0; i < badClients; i++ {
+		structure.ReportOutcomeWithCost(ctx, []byte(fmt.Sprintf("bad-%d", i)), request.OutcomeFailure, 1/conf.Pi)
+	}
+
+	// An innocent client is a false positive when all of its buckets are
+	// shared with bad clients, leaving it a non-zero final probability
+	falsePositives := 0
+	for i := 0; i < innocentClients; i++ {
+		resp := structure.RegisterRequest(ctx, []byte(fmt.Sprintf("innocent-%d", i)))
+		if resp.ResultStats.FinalProbability > 0 {
+			falsePositives++
+		}
+	}
+
+	rate := float64(falsePositives) / innocentClients
+	require.LessOrEqual(t, rate, fpRate)
+	require.Greater(t, falsePositives, 0, "the simulation should exercise collisions")
+}
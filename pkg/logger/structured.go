@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StructuredLogger is implemented by loggers that accept leveled messages with
+// key-value attributes in the style of log/slog. Loggers that only implement
+// Logger still receive structured events, flattened into a Printf call.
+type StructuredLogger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// The minimum level of structured events that get emitted
+var minLevel atomic.Int64
+
+func init() {
+	minLevel.Store(int64(slog.LevelInfo))
+}
+
+// SetLevel sets the minimum level of structured events passed to the logger.
+// The default is slog.LevelInfo.
+func SetLevel(level slog.Level) {
+	minLevel.Store(int64(level))
+}
+
+// GetLevel returns the minimum level of structured events passed to the logger.
+func GetLevel() slog.Level {
+	return slog.Level(minLevel.Load())
+}
+
+// Debug emits a debug level structured event using the current logger
+func Debug(msg string, args ...any) {
+	logAt(slog.LevelDebug, msg, args...)
+}
+
+// Info emits an info level structured event using the current logger
+func Info(msg string, args ...any) {
+	logAt(slog.LevelInfo, msg, args...)
+}
+
+// Warn emits a warn level structured event using the current logger
+func Warn(msg string, args ...any) {
+	logAt(slog.LevelWarn, msg, args...)
+}
+
+// Error emits an error level structured event using the current logger
+func Error(msg string, args ...any) {
+	logAt(slog.LevelError, msg, args...)
+}
+
+func logAt(level slog.Level, msg string, args ...any) {
+	if level < GetLevel() {
+		return
+	}
+
+	l := GetLogger()
+	sl, ok := l.(StructuredLogger)
+	if !ok {
+		l.Printf("%s", formatEvent(level, msg, args...))
+		return
+	}
+
+	switch {
+	case level >= slog.LevelError:
+		sl.Error(msg, args...)
+	case level >= slog.LevelWarn:
+		sl.Warn(msg, args...)
+	case level >= slog.LevelInfo:
+		sl.Info(msg, args...)
+	default:
+		sl.Debug(msg, args...)
+	}
+}
+
+// Flatten a structured event into a single line such as
+// "INFO rotated structures main_id=3 newest_id=4"
+func formatEvent(level slog.Level, msg string, args ...any) string {
+	var sb strings.Builder
+	sb.WriteString(level.String())
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+
+	r := slog.NewRecord(time.Time{}, level, msg, 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+		return true
+	})
+
+	return sb.String()
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger adapts a *slog.Logger so it can be passed to SetLogger.
+// Structured events keep their level and attributes, and Printf-style calls
+// are logged at info level. Fatalf logs at error level and exits the process
+// like NewStdLogger does.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Printf(format string, args ...any) {
+	s.l.Info(fmt.Sprintf(format, args...))
+}
+
+func (s *slogLogger) Print(args ...any) {
+	s.l.Info(fmt.Sprint(args...))
+}
+
+func (s *slogLogger) Println(args ...any) {
+	s.l.Info(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+func (s *slogLogger) Fatalf(format string, args ...any) {
+	s.l.Error(fmt.Sprintf(format, args...))
+	stdLoggerExit(1)
+}
+
+func (s *slogLogger) Debug(msg string, args ...any) {
+	s.l.Debug(msg, args...)
+}
+
+func (s *slogLogger) Info(msg string, args ...any) {
+	s.l.Info(msg, args...)
+}
+
+func (s *slogLogger) Warn(msg string, args ...any) {
+	s.l.Warn(msg, args...)
+}
+
+func (s *slogLogger) Error(msg string, args ...any) {
+	s.l.Error(msg, args...)
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type structuredCall struct {
+	level string
+	msg   string
+	args  []any
+}
+
+type structuredCaptureLogger struct {
+	captureLogger
+	calls []structuredCall
+}
+
+func (s *structuredCaptureLogger) Debug(msg string, args ...any) {
+	s.calls = append(s.calls, structuredCall{level: "debug", msg: msg, args: args})
+}
+
+func (s *structuredCaptureLogger) Info(msg string, args ...any) {
+	s.calls = append(s.calls, structuredCall{level: "info", msg: msg, args: args})
+}
+
+func (s *structuredCaptureLogger) Warn(msg string, args ...any) {
+	s.calls = append(s.calls, structuredCall{level: "warn", msg: msg, args: args})
+}
+
+func (s *structuredCaptureLogger) Error(msg string, args ...any) {
+	s.calls = append(s.calls, structuredCall{level: "error", msg: msg, args: args})
+}
+
+func withLogger(t *testing.T, l Logger, level slog.Level) {
+	t.Helper()
+
+	prevLogger := GetLogger()
+	prevLevel := GetLevel()
+	SetLogger(l)
+	SetLevel(level)
+	t.Cleanup(func() {
+		SetLogger(prevLogger)
+		SetLevel(prevLevel)
+	})
+}
+
+func TestStructured_DispatchesByLevel(t *testing.T) {
+	sl := &structuredCaptureLogger{}
+	withLogger(t, sl, slog.LevelDebug)
+
+	Debug("d", "k", 1)
+	Info("i")
+	Warn("w")
+	Error("e", "err", "boom")
+
+	require.Equal(t, []structuredCall{
+		{level: "debug", msg: "d", args: []any{"k", 1}},
+		{level: "info", msg: "i"},
+		{level: "warn", msg: "w"},
+		{level: "error", msg: "e", args: []any{"err", "boom"}},
+	}, sl.calls)
+	require.False(t, sl.printfCalled)
+}
+
+func TestStructured_FiltersBelowLevel(t *testing.T) {
+	sl := &structuredCaptureLogger{}
+	withLogger(t, sl, slog.LevelWarn)
+
+	Debug("d")
+	Info("i")
+	Warn("w")
+
+	require.Equal(t, []structuredCall{{level: "warn", msg: "w"}}, sl.calls)
+}
+
+func TestStructured_DefaultLevelIsInfo(t *testing.T) {
+	require.Equal(t, slog.LevelInfo, GetLevel())
+}
+
+func TestStructured_FallsBackToPrintf(t *testing.T) {
+	cl := &captureLogger{}
+	withLogger(t, cl, slog.LevelInfo)
+
+	Info("rotated structures", "main_id", 3, "newest_id", 4)
+
+	require.True(t, cl.printfCalled)
+	require.Equal(t, "%s", cl.printfFmt)
+	require.Equal(t, []any{"INFO rotated structures main_id=3 newest_id=4"}, cl.printfArgs)
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	withLogger(t, NewSlogLogger(slog.New(handler)), slog.LevelDebug)
+
+	Warn("dropped", "count", 2)
+	Printf("hello %s", "world")
+
+	require.Equal(t, "level=WARN msg=dropped count=2\nlevel=INFO msg=\"hello world\"\n", buf.String())
+}
+
+func TestSlogLogger_Fatalf(t *testing.T) {
+	prevExit := stdLoggerExit
+	t.Cleanup(func() {
+		stdLoggerExit = prevExit
+	})
+	exitCode := -1
+	stdLoggerExit = func(code int) {
+		exitCode = code
+	}
+	var buf bytes.Buffer
+
+	NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil))).Fatalf("bad %d", 1)
+
+	require.Equal(t, 1, exitCode)
+	require.Contains(t, buf.String(), "level=ERROR msg=\"bad 1\"")
+}
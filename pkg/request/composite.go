@@ -0,0 +1,23 @@
+package request
+
+import "encoding/binary"
+
+// CompositeID combines several parts into a single client identifier so
+// fairness can be maintained per combination, for example per tenant and
+// endpoint pair rather than per tenant. Each part is prefixed with its length,
+// so different splits of the same bytes never produce the same identifier:
+// CompositeID([]byte("ab"), []byte("c")) differs from
+// CompositeID([]byte("a"), []byte("bc")).
+func CompositeID(parts ...[]byte) []byte {
+	size := 0
+	for _, part := range parts {
+		size += binary.MaxVarintLen64 + len(part)
+	}
+
+	id := make([]byte, 0, size)
+	for _, part := range parts {
+		id = binary.AppendUvarint(id, uint64(len(part)))
+		id = append(id, part...)
+	}
+	return id
+}
@@ -0,0 +1,25 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompositeID(t *testing.T) {
+	id := CompositeID([]byte("tenant"), []byte("/search"))
+
+	assert.Equal(t, append([]byte{6}, "tenant\x07/search"...), id)
+	assert.Equal(t, id, CompositeID([]byte("tenant"), []byte("/search")), "should be deterministic")
+}
+
+func TestCompositeID_Unambiguous(t *testing.T) {
+	assert.NotEqual(t, CompositeID([]byte("ab"), []byte("c")), CompositeID([]byte("a"), []byte("bc")))
+	assert.NotEqual(t, CompositeID([]byte("a")), CompositeID([]byte("a"), nil))
+	assert.NotEqual(t, CompositeID([]byte("a"), []byte("b")), CompositeID([]byte("b"), []byte("a")))
+}
+
+func TestCompositeID_Empty(t *testing.T) {
+	assert.Empty(t, CompositeID())
+	assert.Equal(t, []byte{0}, CompositeID(nil))
+}
@@ -0,0 +1,29 @@
+package request
+
+// StatsSchemaVersion is the version of the PublicStats schema. It is bumped
+// whenever a field is removed or changes meaning, but not when fields are
+// added.
+const StatsSchemaVersion = 1
+
+// PublicStats is the stable form of the stats of a decision, meant to be
+// serialized to API consumers. Unlike ResultStats, which follows the internals
+// of the structures, its JSON fields only change with StatsSchemaVersion.
+type PublicStats struct {
+	// Always StatsSchemaVersion
+	SchemaVersion int `json:"schema_version"`
+	// The final probability the decision was based on, including adjustments
+	// such as the overload factor
+	FinalProbability float64 `json:"final_probability"`
+	// The probability of the client's bucket at every level of the structure
+	LevelProbabilities []float64 `json:"level_probabilities"`
+	// The ID of the structure that made the decision
+	StructureID uint64 `json:"structure_id"`
+	// The seed the client identifier was hashed with
+	StructureSeed uint32 `json:"structure_seed"`
+	// How the final probability was turned into a decision, such as
+	// "probabilistic" or "threshold"
+	DecisionMode string `json:"decision_mode"`
+	// The final probability above which requests are throttled. Only set in
+	// the threshold decision mode.
+	ThrottleThreshold *float64 `json:"throttle_threshold,omitempty"`
+}
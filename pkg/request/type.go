@@ -1,6 +1,9 @@
 package request
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Outcome represents the result of a request for resource allocation.
 // It is used to adjust throttling probabilities for future requests.
@@ -16,6 +19,36 @@ const (
 	// upstream service because of a network error would not qualify
 	// as a failure here. See ReportOutcome function for when to report.
 	OutcomeFailure
+
+	// OutcomeTimeout means the request timed out waiting for the resource.
+	// It counts as a failure scaled by its configured Pi multiplier.
+	OutcomeTimeout
+
+	// OutcomeRejected means the resource explicitly rejected the request, for
+	// example because a queue was full. It counts as a failure scaled by its
+	// configured Pi multiplier.
+	OutcomeRejected
+
+	// OutcomeClientError means the request failed because of the client itself,
+	// such as a malformed request. It does not indicate resource contention and
+	// is ignored unless its Pi multiplier is configured.
+	OutcomeClientError
+)
+
+// Priority is the importance of a request. The final probability of a request
+// is scaled by the multiplier configured for its priority, so the low priority
+// traffic of a misbehaving client can be shed before its high priority traffic.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of requests registered without one.
+	PriorityNormal Priority = iota
+
+	// PriorityHigh marks requests that should be shed last.
+	PriorityHigh
+
+	// PriorityLow marks requests that should be shed first.
+	PriorityLow
 )
 
 // RegisterRequestResult is returned from RegisterRequest and indicates whether
@@ -23,6 +56,26 @@ const (
 type RegisterRequestResult struct {
 	// If true, this request should be throttled
 	ShouldThrottle bool
+	// The final throttling probability computed by the fairness structure. It is
+	// set even when stats are disabled, and is zero for rate limited requests.
+	FinalProbability float64
+	// Suggested wait before retrying a throttled request. Only set in the delay
+	// throttle mode.
+	RetryAfter time.Duration
+	// If true, the request would have been throttled but the tracker is running
+	// in the shadow throttle mode
+	ShadowThrottled bool
+	// If true, the decision was made by the per-client rate limit rather than
+	// the fairness structure
+	RateLimited bool
+	// Identifies an admitted request when PendingRequestTTL is set in the
+	// config, so its outcome can be reported with ReportOutcomeByToken. Zero
+	// when no token was issued, such as for throttled requests.
+	Token uint64
+	// Set when the request could not be registered, either to the context
+	// error when the context was done or to an error matching ErrClosed from
+	// the fairerrors package when the tracker is closed. No decision is made.
+	Err error
 	// Probabilities and other useful debugging information
 	ResultStats *ResultStats
 }
@@ -32,15 +85,40 @@ type RegisterRequestResult struct {
 type ResultStats struct {
 	// The final probability used to make the throttling decision
 	FinalProbability float64
-	// The chosen bucket index at every level
+	// The ID of the structure that made the decision
+	StructureID uint64
+	// The seed the client identifier was hashed with. Replicas hashing a client
+	// with the same seed and geometry choose the same buckets.
+	HashSeed uint32
+	// The chosen bucket index at every level, so BucketIndexes[l] is the
+	// column of the bucket in row l
 	BucketIndexes []int
-	// The probabilities of the chosen buckets
+	// The probabilities of the chosen buckets, indexed by level like
+	// BucketIndexes
 	BucketProbabilities []float64
 }
 
-// ReportOutcomeResult is returned from ReportOutcome. It currently carries no
-// fields but exists for future expansion.
-type ReportOutcomeResult struct{}
+// OutcomeReport pairs a client identifier with the outcome of one of its
+// requests. It is used to report outcomes in batches.
+type OutcomeReport struct {
+	// The identifier of the client the outcome belongs to
+	ClientIdentifier []byte
+	// The outcome of the request
+	Outcome Outcome
+}
+
+// ReportOutcomeResult is returned from ReportOutcome. Trackers may return the
+// same result from many calls to avoid allocating, so results must not be
+// modified.
+type ReportOutcomeResult struct {
+	// Set when the outcome could not be recorded, for example because the
+	// tracker is closed
+	Err error
+}
+
+// ReportOutcomeOK is the shared result of a successful report. It must not be
+// modified.
+var ReportOutcomeOK = &ReportOutcomeResult{}
 
 // Tracker defines the operations required by the underlying data structure used
 // to make throttling decisions.
@@ -51,17 +129,34 @@ type Tracker interface {
 	// Register an incoming request from a client identified by a clientIdentifier
 	// The clientIdentifier needs to be unique and consistent for every client as
 	// it will be used to hash and locate the corresponding buckets.
+	// If the context is done, the request is not registered and the result
+	// carries the context error in Err.
 	RegisterRequest(ctx context.Context, clientIdentifier []byte) *RegisterRequestResult
 
+	// Register an incoming request like RegisterRequest, writing the decision
+	// into the given result instead of allocating a new one. The previous
+	// contents of the result are overwritten.
+	RegisterRequestInto(ctx context.Context, clientIdentifier []byte, result *RegisterRequestResult)
+
 	// Report the outcome of a request from the given client so we can update the
 	// probabilities of the corresponding buckets.
 	// Only report the outcomes on the requests where you could either conclusively
-	// get the resource or not. For outcomes such as user errors or network failures
-	// or timeout with upstream, do NOT report any outcome, or we may wrongly throttle
-	// requests based on things not related to resource contention.
+	// get the resource or not. For outcomes such as network failures or timeouts
+	// with an unrelated upstream, do NOT report any outcome, or we may wrongly
+	// throttle requests based on things not related to resource contention.
+	// Timeouts and rejections by the resource itself can be reported with their
+	// own outcomes so they can be weighed differently from failures.
 	// You don't have to report an outcome to every registered request.
+	// Outcomes are recorded even if the context is done, since reporting a
+	// timeout with the request's expired context is a common pattern.
 	ReportOutcome(ctx context.Context, clientIdentifier []byte, outcome Outcome) *ReportOutcomeResult
 
+	// Report the outcome of a request like ReportOutcome, scaling its effect by
+	// the cost of the request. Use this when requests consume very different
+	// amounts of the resource so fairness reflects consumption rather than
+	// request counts. A cost of 1 is equivalent to ReportOutcome.
+	ReportOutcomeWithCost(ctx context.Context, clientIdentifier []byte, outcome Outcome, cost float64) *ReportOutcomeResult
+
 	// Close this tracker when shutting down
 	Close()
 }
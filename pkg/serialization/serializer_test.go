@@ -212,3 +212,38 @@ func createSampleFairStruct() *FairStruct {
 		},
 	}
 }
+
+// Malformed input must be rejected with an error rather than a panic, and
+// anything accepted must survive a round trip.
+func FuzzDeserialize(f *testing.F) {
+	serializer := NewSerializer()
+	binaryData, err := serializer.Serialize(createSampleFairStruct())
+	require.NoError(f, err)
+	jsonData, err := serializer.SerializeToJSON(createSampleFairStruct())
+	require.NoError(f, err)
+	f.Add(binaryData)
+	f.Add(jsonData)
+	f.Add([]byte(`{"cfg": {"pi": "NaN", "m": 4294967295}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if fairStruct, err := serializer.Deserialize(data); err == nil {
+			roundTrip, err := serializer.Serialize(fairStruct)
+			require.NoError(t, err)
+			decoded, err := serializer.Deserialize(roundTrip)
+			if len(roundTrip) == 0 {
+				// An empty message serializes to nothing, which is rejected
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.True(t, proto.Equal(fairStruct, decoded))
+			}
+		}
+
+		if fairStruct, err := serializer.DeserializeFromJSON(data); err == nil {
+			roundTrip, err := serializer.SerializeToJSON(fairStruct)
+			require.NoError(t, err)
+			_, err = serializer.DeserializeFromJSON(roundTrip)
+			require.NoError(t, err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+//go:build !race
+
+// The race detector randomly drops items from sync.Pool, so allocations are
+// only checked without it.
+
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+func TestHotPathDoesNotAllocate(t *testing.T) {
+	ctx := context.Background()
+	id := []byte("client")
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	result := &request.RegisterRequestResult{}
+
+	registerAllocs := testing.AllocsPerRun(1000, func() {
+		trk.RegisterRequestInto(ctx, id, result)
+	})
+	reportAllocs := testing.AllocsPerRun(1000, func() {
+		trk.ReportOutcome(ctx, id, request.OutcomeSuccess)
+	})
+
+	require.Zero(t, registerAllocs, "RegisterRequestInto should not allocate")
+	require.Zero(t, reportAllocs, "ReportOutcome should not allocate")
+}
@@ -0,0 +1,107 @@
+package tracker
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// A final probability cached for a single client
+type cachedProbability struct {
+	clientIdentifier string
+	probability      float64
+	stats            *request.ResultStats
+	expiresAt        time.Time
+}
+
+// decisionCache is a small LRU cache of recent final probabilities, so very
+// hot clients don't hash and lock the buckets on every request. Decisions are
+// still made per request from the cached probability. A cached probability is
+// at most ttl old, which bounds how stale decisions can get.
+type decisionCache struct {
+	capacity int
+	ttl      time.Duration
+	clock    utils.IClock
+
+	// Most recently used entries are at the front
+	entries *list.List
+	index   map[string]*list.Element
+	mu      sync.Mutex
+}
+
+func newDecisionCache(capacity int, ttl time.Duration, clock utils.IClock) *decisionCache {
+	return &decisionCache{
+		capacity: capacity,
+		ttl:      ttl,
+		clock:    clock,
+		entries:  list.New(),
+		index:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// Get the cached probability and stats for the given client if there's one
+// that hasn't expired
+func (dc *decisionCache) get(clientIdentifier []byte) (float64, *request.ResultStats, bool) {
+	now := dc.clock.Now()
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	el, ok := dc.index[string(clientIdentifier)]
+	if !ok {
+		return 0, nil, false
+	}
+	entry := el.Value.(*cachedProbability)
+	if !now.Before(entry.expiresAt) {
+		dc.entries.Remove(el)
+		delete(dc.index, entry.clientIdentifier)
+		return 0, nil, false
+	}
+
+	dc.entries.MoveToFront(el)
+	return entry.probability, entry.stats, true
+}
+
+// Cache the probability and stats for the given client, evicting the least
+// recently used entry if the cache is full
+func (dc *decisionCache) put(clientIdentifier []byte, probability float64, stats *request.ResultStats) {
+	expiresAt := dc.clock.Now().Add(dc.ttl)
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if el, ok := dc.index[string(clientIdentifier)]; ok {
+		entry := el.Value.(*cachedProbability)
+		entry.probability = probability
+		entry.stats = stats
+		entry.expiresAt = expiresAt
+		dc.entries.MoveToFront(el)
+		return
+	}
+
+	if dc.entries.Len() >= dc.capacity {
+		oldest := dc.entries.Back()
+		dc.entries.Remove(oldest)
+		delete(dc.index, oldest.Value.(*cachedProbability).clientIdentifier)
+	}
+
+	entry := &cachedProbability{
+		clientIdentifier: string(clientIdentifier),
+		probability:      probability,
+		stats:            stats,
+		expiresAt:        expiresAt,
+	}
+	dc.index[entry.clientIdentifier] = dc.entries.PushFront(entry)
+}
+
+// Drop all cached entries
+func (dc *decisionCache) clear() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.entries.Init()
+	clear(dc.index)
+}
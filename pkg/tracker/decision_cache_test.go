@@ -0,0 +1,120 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+func TestDecisionCache_GetPut(t *testing.T) {
+	dc := newDecisionCache(2, 10*time.Millisecond, newFakeClock())
+	id := []byte("client")
+	stats := &request.ResultStats{FinalProbability: 0.3}
+
+	_, _, ok := dc.get(id)
+	require.False(t, ok)
+
+	dc.put(id, 0.3, stats)
+	probability, cachedStats, ok := dc.get(id)
+
+	require.True(t, ok)
+	require.Equal(t, 0.3, probability)
+	require.Same(t, stats, cachedStats)
+}
+
+func TestDecisionCache_Expires(t *testing.T) {
+	clk := newFakeClock()
+	dc := newDecisionCache(2, 10*time.Millisecond, clk)
+	id := []byte("client")
+	dc.put(id, 0.3, nil)
+
+	clk.Advance(9 * time.Millisecond)
+	_, _, ok := dc.get(id)
+	require.True(t, ok)
+
+	clk.Advance(time.Millisecond)
+	_, _, ok = dc.get(id)
+	require.False(t, ok)
+	require.Zero(t, dc.entries.Len())
+}
+
+func TestDecisionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	dc := newDecisionCache(2, time.Second, newFakeClock())
+	dc.put([]byte("a"), 0.1, nil)
+	dc.put([]byte("b"), 0.2, nil)
+	_, _, _ = dc.get([]byte("a"))
+
+	dc.put([]byte("c"), 0.3, nil)
+
+	_, _, ok := dc.get([]byte("b"))
+	require.False(t, ok, "b was least recently used")
+	_, _, ok = dc.get([]byte("a"))
+	require.True(t, ok)
+	_, _, ok = dc.get([]byte("c"))
+	require.True(t, ok)
+}
+
+func TestDecisionCache_PutUpdatesExisting(t *testing.T) {
+	dc := newDecisionCache(1, time.Second, newFakeClock())
+	id := []byte("client")
+	dc.put(id, 0.1, nil)
+
+	dc.put(id, 0.5, nil)
+
+	probability, _, ok := dc.get(id)
+	require.True(t, ok)
+	require.Equal(t, 0.5, probability)
+	require.Equal(t, 1, dc.entries.Len())
+}
+
+func TestDecisionCache_Clear(t *testing.T) {
+	dc := newDecisionCache(2, time.Second, newFakeClock())
+	dc.put([]byte("a"), 0.1, nil)
+
+	dc.clear()
+
+	_, _, ok := dc.get([]byte("a"))
+	require.False(t, ok)
+	require.Empty(t, dc.index)
+}
+
+func TestFairnessTracker_DecisionCache(t *testing.T) {
+	clk := newFakeClock()
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.DecisionCacheSize = 10
+	conf.DecisionCacheTTL = 10 * time.Millisecond
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.5
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, clk, newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("hot_client")
+
+	require.False(t, trk.RegisterRequest(ctx, id).ShouldThrottle)
+	trk.ReportOutcomeWithCost(ctx, id, request.OutcomeFailure, 25)
+
+	resp := trk.RegisterRequest(ctx, id)
+	require.False(t, resp.ShouldThrottle, "the cached probability should be used within the TTL")
+	require.Zero(t, resp.FinalProbability)
+
+	clk.Advance(10 * time.Millisecond)
+	resp = trk.RegisterRequest(ctx, id)
+	require.True(t, resp.ShouldThrottle, "the probability should be refreshed after the TTL")
+	require.InDelta(t, 1.0, resp.FinalProbability, 1e-3)
+}
+
+func TestNewFairnessTracker_DecisionCacheRequiresTTL(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.DecisionCacheSize = 10
+
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, newFakeClock(), newFakeTicker())
+
+	require.Nil(t, trk)
+	require.Error(t, err)
+}
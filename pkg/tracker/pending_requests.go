@@ -0,0 +1,113 @@
+package tracker
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// A request that was admitted and whose outcome hasn't been reported yet
+type pendingRequest struct {
+	token            uint64
+	clientIdentifier string
+	expiresAt        time.Time
+}
+
+// pendingRequests tracks admitted requests by token until their outcome is
+// reported. Every request gets the same TTL, so they expire in the order they
+// were added and the oldest is always at the front.
+type pendingRequests struct {
+	ttl   time.Duration
+	clock utils.IClock
+
+	nextToken uint64
+	// Oldest requests are at the front
+	entries  *list.List
+	index    map[uint64]*list.Element
+	inFlight map[string]int
+	mu       sync.Mutex
+}
+
+func newPendingRequests(ttl time.Duration, clock utils.IClock) *pendingRequests {
+	return &pendingRequests{
+		ttl:      ttl,
+		clock:    clock,
+		entries:  list.New(),
+		index:    make(map[uint64]*list.Element),
+		inFlight: make(map[string]int),
+	}
+}
+
+// Track a request of the given client and return its token, which is never
+// zero
+func (pr *pendingRequests) add(clientIdentifier []byte) uint64 {
+	expiresAt := pr.clock.Now().Add(pr.ttl)
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	pr.nextToken++
+	entry := &pendingRequest{
+		token:            pr.nextToken,
+		clientIdentifier: string(clientIdentifier),
+		expiresAt:        expiresAt,
+	}
+	pr.index[entry.token] = pr.entries.PushBack(entry)
+	pr.inFlight[entry.clientIdentifier]++
+	return entry.token
+}
+
+// Stop tracking the request with the given token and return its client, or
+// false if the token is unknown or already expired or taken
+func (pr *pendingRequests) take(token uint64) ([]byte, bool) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	el, ok := pr.index[token]
+	if !ok {
+		return nil, false
+	}
+	entry := pr.remove(el)
+	return []byte(entry.clientIdentifier), true
+}
+
+// Stop tracking requests whose TTL has passed and return their clients, with
+// one entry per request
+func (pr *pendingRequests) expire() [][]byte {
+	now := pr.clock.Now()
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	var expired [][]byte
+	for el := pr.entries.Front(); el != nil; el = pr.entries.Front() {
+		if now.Before(el.Value.(*pendingRequest).expiresAt) {
+			break
+		}
+		entry := pr.remove(el)
+		expired = append(expired, []byte(entry.clientIdentifier))
+	}
+	return expired
+}
+
+// The number of tracked requests of the given client
+func (pr *pendingRequests) count(clientIdentifier []byte) int {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	return pr.inFlight[string(clientIdentifier)]
+}
+
+// Remove an entry. The caller must hold the lock.
+func (pr *pendingRequests) remove(el *list.Element) *pendingRequest {
+	entry := pr.entries.Remove(el).(*pendingRequest)
+	delete(pr.index, entry.token)
+	if pr.inFlight[entry.clientIdentifier] <= 1 {
+		delete(pr.inFlight, entry.clientIdentifier)
+	} else {
+		pr.inFlight[entry.clientIdentifier]--
+	}
+	return entry
+}
@@ -0,0 +1,50 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingRequests_AddTake(t *testing.T) {
+	pr := newPendingRequests(time.Second, newFakeClock())
+	id := []byte("client")
+
+	first := pr.add(id)
+	second := pr.add(id)
+
+	require.NotZero(t, first)
+	require.NotEqual(t, first, second)
+	require.Equal(t, 2, pr.count(id))
+
+	clientIdentifier, ok := pr.take(first)
+	require.True(t, ok)
+	require.Equal(t, id, clientIdentifier)
+	require.Equal(t, 1, pr.count(id))
+
+	_, ok = pr.take(first)
+	require.False(t, ok, "a token can only be taken once")
+	_, ok = pr.take(12345)
+	require.False(t, ok)
+}
+
+func TestPendingRequests_Expire(t *testing.T) {
+	clk := newFakeClock()
+	pr := newPendingRequests(10*time.Millisecond, clk)
+	early, late := []byte("early"), []byte("late")
+	pr.add(early)
+	clk.Advance(5 * time.Millisecond)
+	lateToken := pr.add(late)
+
+	clk.Advance(5 * time.Millisecond)
+	require.Equal(t, [][]byte{early}, pr.expire())
+	require.Zero(t, pr.count(early))
+	require.Equal(t, 1, pr.count(late))
+
+	clk.Advance(5 * time.Millisecond)
+	require.Equal(t, [][]byte{late}, pr.expire())
+	require.Nil(t, pr.expire())
+	_, ok := pr.take(lateToken)
+	require.False(t, ok, "expired requests can't be reported")
+}
@@ -0,0 +1,32 @@
+package tracker
+
+import "github.com/satmihir/fair/pkg/identity"
+
+// PrivateClientIdentifier returns the salted hash that replaces the given
+// client identifier in the outputs of a tracker whose config sets the given
+// PrivacySalt. Use it to look a known client up in the most throttled clients,
+// observer events or recordings. Outputs hash identifiers as tracked, so pass
+// the identifier after IdentifierNormalizer if the config sets one. The hash
+// can't be computed, or reversed, without the salt.
+func PrivateClientIdentifier(salt, clientIdentifier []byte) []byte {
+	return identity.HMAC(salt)(clientIdentifier)
+}
+
+// The identifier of a client as exposed in outputs, which is its salted hash
+// when PrivacySalt is set
+func (ft *FairnessTracker) outputIdentifier(clientIdentifier []byte) []byte {
+	if ft.privateIdentifier == nil {
+		return clientIdentifier
+	}
+	return ft.privateIdentifier(clientIdentifier)
+}
+
+// The identifier of a client as recorded. Without PrivacySalt it is recorded
+// as passed, so replays normalize it again. Otherwise it is hashed after
+// normalization like every other output.
+func (ft *FairnessTracker) recordedIdentifier(clientIdentifier []byte) []byte {
+	if ft.privateIdentifier == nil {
+		return clientIdentifier
+	}
+	return ft.privateIdentifier(normalizeIdentifier(ft.current.Load().config, clientIdentifier))
+}
@@ -0,0 +1,57 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+func TestPrivacySalt(t *testing.T) {
+	salt := []byte("salt")
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.4
+	conf.TopThrottledClientsCapacity = 10
+	conf.PrivacySalt = salt
+	conf.IdentifierNormalizer = bytes.ToLower
+	observer := &recordingObserver{}
+	conf.Observer = observer
+	var recording bytes.Buffer
+	rt, err := NewRecordingTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker(), &recording)
+	require.NoError(t, err)
+	defer rt.Close()
+	ctx := context.Background()
+	id := []byte("User@Example.com")
+	// Every output hashes the normalized identifier
+	private := PrivateClientIdentifier(salt, []byte("user@example.com"))
+
+	rt.ReportOutcome(ctx, id, request.OutcomeFailure)
+	require.True(t, rt.RegisterRequest(ctx, id).ShouldThrottle, "decisions still use the client identifier")
+
+	top := rt.tracker.GetTopThrottledClients(1)
+	require.Len(t, top, 1)
+	require.Equal(t, private, top[0].Key)
+	require.Equal(t, [][]byte{private}, observer.throttled)
+	require.NotContains(t, recording.String(), "xample.com")
+	decoder := json.NewDecoder(&recording)
+	for decoder.More() {
+		var op RecordedOp
+		require.NoError(t, decoder.Decode(&op))
+		if op.Op != OpStart {
+			require.Equal(t, private, op.ClientIdentifier)
+		}
+	}
+
+	require.NotEqual(t, private, PrivateClientIdentifier([]byte("other-salt"), id))
+	require.Nil(t, rt.tracker.GetConfig().PrivacySalt, "the salt must not leak through debug endpoints")
+}
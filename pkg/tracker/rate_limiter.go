@@ -0,0 +1,92 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// A token bucket holding the rate limiting state of a single client
+type tokenBucket struct {
+	tokens                float64
+	lastUpdatedTimeMillis uint64
+}
+
+// rateLimiter enforces an absolute per-client request rate in front of the
+// fairness structures. Buckets are created lazily and pruned once they refill,
+// since a full bucket is indistinguishable from a new one. Memory is therefore
+// bounded by the number of clients active within one prune interval.
+type rateLimiter struct {
+	ratePerSecond float64
+	burst         float64
+	clock         utils.IClock
+
+	buckets map[string]*tokenBucket
+	mu      sync.Mutex
+}
+
+func newRateLimiter(ratePerSecond float64, burst uint32, clock utils.IClock) *rateLimiter {
+	if burst == 0 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		ratePerSecond: ratePerSecond,
+		burst:         float64(burst),
+		clock:         clock,
+		buckets:       make(map[string]*tokenBucket),
+	}
+}
+
+// Take a token for the given client. If none is available, return false along
+// with the time until the next token is available.
+func (rl *rateLimiter) take(clientIdentifier []byte) (bool, time.Duration) {
+	now := uint64(rl.clock.Now().UnixMilli())
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.buckets[string(clientIdentifier)]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, lastUpdatedTimeMillis: now}
+		rl.buckets[string(clientIdentifier)] = b
+	}
+	rl.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / rl.ratePerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Remove the buckets that have fully refilled
+func (rl *rateLimiter) prune() {
+	now := uint64(rl.clock.Now().UnixMilli())
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for id, b := range rl.buckets {
+		rl.refill(b, now)
+		if b.tokens >= rl.burst {
+			delete(rl.buckets, id)
+		}
+	}
+}
+
+func (rl *rateLimiter) refill(b *tokenBucket, now uint64) {
+	if now <= b.lastUpdatedTimeMillis {
+		return
+	}
+
+	elapsedSec := float64(now-b.lastUpdatedTimeMillis) / 1000
+	b.tokens += elapsedSec * rl.ratePerSecond
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.lastUpdatedTimeMillis = now
+}
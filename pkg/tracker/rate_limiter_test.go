@@ -0,0 +1,142 @@
+package tracker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+)
+
+type fakeClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Sleep(d time.Duration) {
+	f.Advance(d)
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestRateLimiter_AllowsBurstThenRefills(t *testing.T) {
+	clk := newFakeClock()
+	rl := newRateLimiter(2, 3, clk)
+	id := []byte("client")
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := rl.take(id)
+		require.True(t, allowed, "request %d should be within the burst", i)
+	}
+	allowed, wait := rl.take(id)
+	require.False(t, allowed)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	clk.Advance(499 * time.Millisecond)
+	allowed, _ = rl.take(id)
+	require.False(t, allowed)
+
+	clk.Advance(time.Millisecond)
+	allowed, _ = rl.take(id)
+	require.True(t, allowed)
+}
+
+func TestRateLimiter_ClientsAreIndependent(t *testing.T) {
+	rl := newRateLimiter(1, 1, newFakeClock())
+
+	allowedA, _ := rl.take([]byte("a"))
+	allowedB, _ := rl.take([]byte("b"))
+	allowedA2, _ := rl.take([]byte("a"))
+
+	require.True(t, allowedA)
+	require.True(t, allowedB)
+	require.False(t, allowedA2)
+}
+
+func TestRateLimiter_ZeroBurstIsOne(t *testing.T) {
+	rl := newRateLimiter(1, 0, newFakeClock())
+
+	allowed, _ := rl.take([]byte("a"))
+	allowed2, _ := rl.take([]byte("a"))
+
+	require.True(t, allowed)
+	require.False(t, allowed2)
+}
+
+func TestRateLimiter_PruneRemovesOnlyRefilledBuckets(t *testing.T) {
+	clk := newFakeClock()
+	rl := newRateLimiter(1, 2, clk)
+	rl.take([]byte("idle"))
+	clk.Advance(time.Second)
+	rl.take([]byte("busy"))
+
+	rl.prune()
+
+	require.NotContains(t, rl.buckets, "idle")
+	require.Contains(t, rl.buckets, "busy")
+}
+
+func TestFairnessTracker_RateLimit(t *testing.T) {
+	testCases := []struct {
+		name           string
+		mode           config.ThrottleMode
+		shouldThrottle bool
+		shadow         bool
+		retryAfter     time.Duration
+	}{
+		{name: "reject", mode: config.ThrottleModeReject, shouldThrottle: true},
+		{name: "delay", mode: config.ThrottleModeDelay, shouldThrottle: true, retryAfter: time.Second},
+		{name: "shadow", mode: config.ThrottleModeShadow, shadow: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := config.DefaultFairnessTrackerConfig()
+			conf.MaxRPS = 1
+			conf.Burst = 1
+			conf.ThrottleMode = tc.mode
+			trk, err := NewFairnessTrackerWithClockAndTicker(conf, newFakeClock(), newFakeTicker())
+			require.NoError(t, err)
+			defer trk.Close()
+			ctx := context.Background()
+			id := []byte("client")
+
+			first := trk.RegisterRequest(ctx, id)
+			second := trk.RegisterRequest(ctx, id)
+
+			require.False(t, first.RateLimited)
+			require.False(t, first.ShouldThrottle)
+			require.True(t, second.RateLimited)
+			require.Equal(t, tc.shouldThrottle, second.ShouldThrottle)
+			require.Equal(t, tc.shadow, second.ShadowThrottled)
+			require.Equal(t, tc.retryAfter, second.RetryAfter)
+		})
+	}
+}
+
+func TestFairnessTracker_RateLimitNegative(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.MaxRPS = -1
+
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, newFakeClock(), newFakeTicker())
+
+	require.Nil(t, trk)
+	require.Error(t, err)
+}
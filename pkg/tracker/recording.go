@@ -0,0 +1,193 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/logger"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+// The operations in a recording
+const (
+	// OpStart marks the creation of the tracker. It is always the first entry.
+	OpStart = "start"
+	// OpRegister is a registered request along with its decision.
+	OpRegister = "register"
+	// OpReport is a reported outcome.
+	OpReport = "report"
+	// OpRotate is a rotation of the structures.
+	OpRotate = "rotate"
+)
+
+// RecordedOp is a single entry of a recording. Recordings are written as one
+// JSON object per line.
+type RecordedOp struct {
+	// When the operation happened according to the tracker's clock
+	Time time.Time `json:"time"`
+	// The kind of operation, such as OpRegister
+	Op string `json:"op"`
+	// The client the operation is about. Empty for OpStart and OpRotate.
+	ClientIdentifier []byte `json:"client,omitempty"`
+	// The reported outcome for OpReport
+	Outcome request.Outcome `json:"outcome,omitempty"`
+	// The cost of the reported outcome for OpReport
+	Cost float64 `json:"cost,omitempty"`
+	// The final probability the decision was based on for OpRegister
+	FinalProbability float64 `json:"final_probability,omitempty"`
+	// Whether the request was throttled for OpRegister
+	Throttled bool `json:"throttled,omitempty"`
+	// Whether the request would have been throttled in the shadow throttle
+	// mode for OpRegister
+	ShadowThrottled bool `json:"shadow_throttled,omitempty"`
+}
+
+// RecordingTracker wraps a FairnessTracker and appends every registered
+// request, reported outcome and rotation to a log, so the decisions can be
+// reproduced later with Replay. Only the operations it exposes are recorded.
+// Replays are exact when HashSeed is set in the config, since the buckets of
+// a client otherwise depend on random seeds, and when no operation runs
+// concurrently with a rotation, since it may be logged on either side of it.
+// Client identifiers are recorded as passed, before IdentifierNormalizer is
+// applied, so protect recordings like any other log of raw identifiers, or set
+// PrivacySalt to record the salted hashes of the normalized identifiers, as in
+// every other output, instead. Replays of such
+// recordings track the same flows, but their buckets differ, so probabilities
+// are only reproduced approximately.
+type RecordingTracker struct {
+	tracker *FairnessTracker
+	clock   utils.IClock
+
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+// NewRecordingTracker creates a tracker that records its operations to the
+// given writer, using the real system clock and ticker. Writes are not
+// buffered, so wrap the writer in a bufio.Writer on hot paths.
+func NewRecordingTracker(trackerConfig *config.FairnessTrackerConfig, w io.Writer) (*RecordingTracker, error) {
+	if trackerConfig == nil {
+		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
+	}
+	if err := validateConfigForRealTicker(trackerConfig); err != nil {
+		return nil, err
+	}
+	return NewRecordingTrackerWithClockAndTicker(trackerConfig, utils.NewRealClock(), utils.NewRealTicker(trackerConfig.RotationFrequency), w)
+}
+
+// NewRecordingTrackerWithClockAndTicker creates a recording tracker using the
+// provided clock and ticker.
+func NewRecordingTrackerWithClockAndTicker(trackerConfig *config.FairnessTrackerConfig, clock utils.IClock, ticker utils.ITicker, w io.Writer) (*RecordingTracker, error) {
+	rt := &RecordingTracker{
+		clock:   clock,
+		encoder: json.NewEncoder(w),
+	}
+
+	if trackerConfig != nil {
+		configCopy := *trackerConfig
+		configCopy.Observer = &rotationRecorder{recorder: rt, next: trackerConfig.Observer}
+		trackerConfig = &configCopy
+	}
+
+	start := clock.Now()
+	trk, err := NewFairnessTrackerWithClockAndTicker(trackerConfig, clock, ticker)
+	if err != nil {
+		return nil, err
+	}
+	rt.tracker = trk
+	rt.record(&RecordedOp{Time: start, Op: OpStart})
+
+	return rt, nil
+}
+
+// RegisterRequest registers the request with the tracker and records the
+// decision.
+func (rt *RecordingTracker) RegisterRequest(ctx context.Context, clientIdentifier []byte) *request.RegisterRequestResult {
+	resp := &request.RegisterRequestResult{}
+	rt.RegisterRequestInto(ctx, clientIdentifier, resp)
+	return resp
+}
+
+// RegisterRequestInto works like RegisterRequest but writes the decision into
+// the given result.
+func (rt *RecordingTracker) RegisterRequestInto(ctx context.Context, clientIdentifier []byte, resp *request.RegisterRequestResult) {
+	now := rt.clock.Now()
+	rt.tracker.RegisterRequestInto(ctx, clientIdentifier, resp)
+	if resp.Err != nil {
+		return
+	}
+
+	rt.record(&RecordedOp{
+		Time:             now,
+		Op:               OpRegister,
+		ClientIdentifier: rt.tracker.recordedIdentifier(clientIdentifier),
+		FinalProbability: resp.FinalProbability,
+		Throttled:        resp.ShouldThrottle,
+		ShadowThrottled:  resp.ShadowThrottled,
+	})
+}
+
+// ReportOutcome reports the outcome to the tracker and records it.
+func (rt *RecordingTracker) ReportOutcome(ctx context.Context, clientIdentifier []byte, outcome request.Outcome) *request.ReportOutcomeResult {
+	return rt.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, 1)
+}
+
+// ReportOutcomeWithCost reports the outcome with a cost to the tracker and
+// records it.
+func (rt *RecordingTracker) ReportOutcomeWithCost(ctx context.Context, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	now := rt.clock.Now()
+	resp := rt.tracker.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, cost)
+	if resp.Err != nil {
+		return resp
+	}
+
+	rt.record(&RecordedOp{
+		Time:             now,
+		Op:               OpReport,
+		ClientIdentifier: rt.tracker.recordedIdentifier(clientIdentifier),
+		Outcome:          outcome,
+		Cost:             cost,
+	})
+	return resp
+}
+
+// Close closes the tracker. The writer is left open.
+func (rt *RecordingTracker) Close() {
+	rt.tracker.Close()
+}
+
+// Append an operation to the log. Failed writes are logged and otherwise
+// ignored so recording never affects decisions.
+func (rt *RecordingTracker) record(op *RecordedOp) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if err := rt.encoder.Encode(op); err != nil {
+		logger.Error("failed to record operation", "op", op.Op, "error", err)
+	}
+}
+
+// Records rotations and forwards every event to the observer of the config
+type rotationRecorder struct {
+	recorder *RecordingTracker
+	next     config.Observer
+}
+
+func (ro *rotationRecorder) OnThrottle(clientIdentifier []byte, result *request.RegisterRequestResult) {
+	if ro.next != nil {
+		ro.next.OnThrottle(clientIdentifier, result)
+	}
+}
+
+func (ro *rotationRecorder) OnRotation(retiredID, newID uint64) {
+	ro.recorder.record(&RecordedOp{Time: ro.recorder.clock.Now(), Op: OpRotate})
+	if ro.next != nil {
+		ro.next.OnRotation(retiredID, newID)
+	}
+}
@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	// A small structure so clients collide and the replay depends on the seeds
+	conf.M = 10
+	conf.L = 3
+	conf.Pi = 0.2
+	conf.Pd = 0.05
+	conf.HashSeed = 42
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.3
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf.Observer = observer
+	clk := newFakeClock()
+	ticker := newFakeTicker()
+	var recording bytes.Buffer
+	rt, err := NewRecordingTrackerWithClockAndTicker(conf, clk, ticker, &recording)
+	require.NoError(t, err)
+	defer rt.Close()
+	ctx := context.Background()
+
+	var recorded []*request.RegisterRequestResult
+	for round := range 20 {
+		if round == 10 {
+			ticker.ch <- clk.Now()
+			<-observer.rotations
+		}
+		for c := range 8 {
+			id := []byte(fmt.Sprintf("client-%d", c))
+			recorded = append(recorded, rt.RegisterRequest(ctx, id))
+			outcome := request.OutcomeSuccess
+			if c%4 == 0 {
+				outcome = request.OutcomeFailure
+			}
+			rt.ReportOutcomeWithCost(ctx, id, outcome, float64(c%3+1))
+			clk.Advance(100 * time.Millisecond)
+		}
+	}
+
+	decisions, err := Replay(&recording, conf)
+
+	require.NoError(t, err)
+	require.Len(t, decisions, len(recorded))
+	var throttled int
+	for i, decision := range decisions {
+		require.Equal(t, recorded[i].FinalProbability, decision.RecordedProbability)
+		require.Equal(t, decision.RecordedProbability, decision.ReplayedProbability, "decision %d", i)
+		require.Equal(t, decision.RecordedThrottled, decision.ReplayedThrottled, "decision %d", i)
+		if decision.ReplayedThrottled {
+			throttled++
+		}
+	}
+	require.Positive(t, throttled)
+}
+
+func TestRecordAndReplay_ShadowMode(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Lambda = 0
+	conf.HashSeed = 42
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.4
+	conf.ThrottleMode = config.ThrottleModeShadow
+	var recording bytes.Buffer
+	rt, err := NewRecordingTrackerWithClockAndTicker(conf, newFakeClock(), newFakeTicker(), &recording)
+	require.NoError(t, err)
+	defer rt.Close()
+	ctx := context.Background()
+	rt.ReportOutcome(ctx, []byte("bad"), request.OutcomeFailure)
+	require.True(t, rt.RegisterRequest(ctx, []byte("bad")).ShadowThrottled)
+
+	decisions, err := Replay(&recording, conf)
+
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	require.False(t, decisions[0].RecordedThrottled)
+	require.True(t, decisions[0].RecordedShadowThrottled)
+	require.True(t, decisions[0].ReplayedShadowThrottled)
+}
+
+func TestReplay_Errors(t *testing.T) {
+	testCases := map[string]string{
+		"empty":           "",
+		"missing start":   `{"time":"2024-01-01T00:00:00Z","op":"rotate"}`,
+		"unknown op":      `{"time":"2024-01-01T00:00:00Z","op":"start"}` + "\n" + `{"time":"2024-01-01T00:00:00Z","op":"resize"}`,
+		"malformed entry": `{"time":"2024-01-01T00:00:00Z","op":"start"}` + "\n{",
+	}
+
+	for name, recording := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decisions, err := Replay(strings.NewReader(recording), config.DefaultFairnessTrackerConfig())
+
+			require.Error(t, err)
+			require.Nil(t, decisions)
+		})
+	}
+
+	_, err := Replay(strings.NewReader(""), nil)
+	require.ErrorIs(t, err, fairerrors.ErrNilConfig)
+}
@@ -0,0 +1,145 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+)
+
+// ReplayedDecision pairs a decision from a recording with the decision a fresh
+// tracker made for the same request on replay.
+type ReplayedDecision struct {
+	// When the request was registered
+	Time time.Time
+	// The client that sent the request
+	ClientIdentifier []byte
+	// The final probability and decision that were recorded
+	RecordedProbability     float64
+	RecordedThrottled       bool
+	RecordedShadowThrottled bool
+	// The final probability and decision made on replay
+	ReplayedProbability     float64
+	ReplayedThrottled       bool
+	ReplayedShadowThrottled bool
+}
+
+// Replay feeds a recording written by a RecordingTracker into a fresh tracker
+// built from the given config, driving its clock and rotations from the
+// recorded times, and returns a decision for every recorded request in order.
+// Use the config the recording was made with. Final probabilities are
+// reproduced exactly when HashSeed is set. Decisions in the probabilistic mode
+// also depend on a random draw, so the final probability is what explains
+// them. The observer in the config is not called.
+func Replay(r io.Reader, trackerConfig *config.FairnessTrackerConfig) ([]ReplayedDecision, error) {
+	if trackerConfig == nil {
+		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
+	}
+
+	decoder := json.NewDecoder(r)
+	var start RecordedOp
+	if err := decoder.Decode(&start); err != nil {
+		return nil, fmt.Errorf("failed to read the start of the recording: %w", err)
+	}
+	if start.Op != OpStart {
+		return nil, fmt.Errorf("the recording must begin with a %q entry, found: %q", OpStart, start.Op)
+	}
+
+	rotations := make(chan struct{})
+	configCopy := *trackerConfig
+	configCopy.Observer = &replayObserver{rotations: rotations}
+	clock := &manualClock{now: start.Time}
+	ticker := &manualTicker{ch: make(chan time.Time)}
+	trk, err := NewFairnessTrackerWithClockAndTicker(&configCopy, clock, ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer trk.Close()
+
+	ctx := context.Background()
+	var decisions []ReplayedDecision
+	for entry := 1; ; entry++ {
+		var op RecordedOp
+		if err := decoder.Decode(&op); err != nil {
+			if errors.Is(err, io.EOF) {
+				return decisions, nil
+			}
+			return nil, fmt.Errorf("failed to read entry %d of the recording: %w", entry, err)
+		}
+		clock.set(op.Time)
+
+		switch op.Op {
+		case OpRegister:
+			resp := trk.RegisterRequest(ctx, op.ClientIdentifier)
+			decisions = append(decisions, ReplayedDecision{
+				Time:                    op.Time,
+				ClientIdentifier:        op.ClientIdentifier,
+				RecordedProbability:     op.FinalProbability,
+				RecordedThrottled:       op.Throttled,
+				RecordedShadowThrottled: op.ShadowThrottled,
+				ReplayedProbability:     resp.FinalProbability,
+				ReplayedThrottled:       resp.ShouldThrottle,
+				ReplayedShadowThrottled: resp.ShadowThrottled,
+			})
+		case OpReport:
+			trk.ReportOutcomeWithCost(ctx, op.ClientIdentifier, op.Outcome, op.Cost)
+		case OpRotate:
+			// Rotations happen in the background, so wait for it to finish
+			ticker.ch <- op.Time
+			<-rotations
+		default:
+			return nil, fmt.Errorf("unknown operation in entry %d of the recording: %q", entry, op.Op)
+		}
+	}
+}
+
+// A clock set explicitly by the replay
+type manualClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.set(c.Now().Add(d))
+}
+
+func (c *manualClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// A ticker fired explicitly by the replay
+type manualTicker struct {
+	ch chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *manualTicker) Stop() {}
+
+func (t *manualTicker) Reset(_ time.Duration) {}
+
+// Signals the replay when a rotation is done
+type replayObserver struct {
+	config.BaseObserver
+	rotations chan struct{}
+}
+
+func (ro *replayObserver) OnRotation(_, _ uint64) {
+	ro.rotations <- struct{}{}
+}
@@ -0,0 +1,62 @@
+package tracker
+
+import (
+	"sync"
+
+	"github.com/satmihir/fair/pkg/data"
+)
+
+// resourceAccess keeps a small sketch per shared resource of the clients that
+// recently accessed it, so failures of the resource can be attributed to the
+// clients that loaded it rather than to whichever client happened to see the
+// failure. Each sketch tracks twice as many clients as the blast radius so
+// the counts of the heaviest ones are accurate. Sketches are dropped on
+// rotation, so memory is bounded by the number of resources accessed within
+// one rotation period.
+type resourceAccess struct {
+	blastRadius int
+
+	sketches map[string]*data.HeavyHitters
+	mu       sync.Mutex
+}
+
+func newResourceAccess(blastRadius int) *resourceAccess {
+	return &resourceAccess{
+		blastRadius: blastRadius,
+		sketches:    make(map[string]*data.HeavyHitters),
+	}
+}
+
+// Record an access of the given resource by the given client
+func (ra *resourceAccess) record(resourceKey []byte, clientIdentifier []byte) {
+	ra.mu.Lock()
+	sketch, ok := ra.sketches[string(resourceKey)]
+	if !ok {
+		sketch = data.NewHeavyHitters(2 * ra.blastRadius)
+		ra.sketches[string(resourceKey)] = sketch
+	}
+	ra.mu.Unlock()
+
+	sketch.Add(clientIdentifier)
+}
+
+// Get the heaviest recent clients of the given resource along with their
+// access counts, ordered by descending count
+func (ra *resourceAccess) accessors(resourceKey []byte) []data.HeavyHitter {
+	ra.mu.Lock()
+	sketch, ok := ra.sketches[string(resourceKey)]
+	ra.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return sketch.Top(ra.blastRadius)
+}
+
+// Forget all recorded accesses
+func (ra *resourceAccess) clear() {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	clear(ra.sketches)
+}
@@ -0,0 +1,30 @@
+package tracker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/data"
+)
+
+func TestResourceAccess(t *testing.T) {
+	ra := newResourceAccess(2)
+	resource := []byte("shard-1")
+	for range 5 {
+		ra.record(resource, []byte("heavy"))
+	}
+	ra.record(resource, []byte("light"))
+	ra.record(resource, []byte("light"))
+	ra.record(resource, []byte("rare"))
+	ra.record([]byte("shard-2"), []byte("other"))
+
+	require.Equal(t, []data.HeavyHitter{
+		{Key: []byte("heavy"), Count: 5},
+		{Key: []byte("light"), Count: 2},
+	}, ra.accessors(resource), "only the heaviest clients up to the blast radius are kept")
+	require.Nil(t, ra.accessors([]byte("unknown")))
+
+	ra.clear()
+	require.Nil(t, ra.accessors(resource))
+}
@@ -0,0 +1,123 @@
+package tracker
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/satmihir/fair/pkg/data"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// ShadowEvaluator feeds the same stream of requests and outcomes to a primary
+// tracker and to a shadow tracker built with a candidate config. Only the
+// decisions of the primary are returned, and the evaluator counts how often
+// the shadow would have decided differently. It lets a config be tried in
+// production before it's rolled out. Both trackers decide every request from
+// the same random draws, so in the probabilistic mode they only disagree where
+// their configs or states do. Both trackers are owned by the evaluator and
+// closed with it.
+type ShadowEvaluator struct {
+	primary *FairnessTracker
+	shadow  *FairnessTracker
+
+	requests        atomic.Uint64
+	agreements      atomic.Uint64
+	extraThrottles  atomic.Uint64
+	missedThrottles atomic.Uint64
+}
+
+// ShadowStats summarizes how the decisions of the shadow tracker compared to
+// those of the primary tracker. Decisions made in the shadow throttle mode
+// count as throttles, so either tracker may use it.
+type ShadowStats struct {
+	// Number of requests both trackers made a decision for
+	Requests uint64
+	// Number of requests both trackers made the same decision for
+	Agreements uint64
+	// Number of requests only the shadow tracker would have throttled
+	ExtraThrottles uint64
+	// Number of requests only the primary tracker throttled
+	MissedThrottles uint64
+}
+
+// AgreementRate returns the share of requests both trackers made the same
+// decision for, or 1 if there were no requests.
+func (ss ShadowStats) AgreementRate() float64 {
+	if ss.Requests == 0 {
+		return 1
+	}
+	return float64(ss.Agreements) / float64(ss.Requests)
+}
+
+// NewShadowEvaluator creates an evaluator comparing the decisions of the
+// shadow tracker against those of the primary tracker.
+func NewShadowEvaluator(primary *FairnessTracker, shadow *FairnessTracker) *ShadowEvaluator {
+	return &ShadowEvaluator{
+		primary: primary,
+		shadow:  shadow,
+	}
+}
+
+// RegisterRequest registers the request with both trackers and returns the
+// decision of the primary.
+func (se *ShadowEvaluator) RegisterRequest(ctx context.Context, clientIdentifier []byte) *request.RegisterRequestResult {
+	resp := &request.RegisterRequestResult{}
+	se.RegisterRequestInto(ctx, clientIdentifier, resp)
+	return resp
+}
+
+// RegisterRequestInto works like RegisterRequest but writes the decision of the
+// primary into the given result.
+func (se *ShadowEvaluator) RegisterRequestInto(ctx context.Context, clientIdentifier []byte, resp *request.RegisterRequestResult) {
+	draws := data.NewDraws()
+	se.primary.registerRequest(ctx, se.primary.current.Load(), clientIdentifier, request.PriorityNormal, &draws, resp)
+
+	scratch := scratchResults.Get().(*request.RegisterRequestResult)
+	defer scratchResults.Put(scratch)
+	se.shadow.registerRequest(ctx, se.shadow.current.Load(), clientIdentifier, request.PriorityNormal, &draws, scratch)
+
+	if resp.Err != nil || scratch.Err != nil {
+		return
+	}
+
+	primaryThrottled := resp.ShouldThrottle || resp.ShadowThrottled
+	shadowThrottled := scratch.ShouldThrottle || scratch.ShadowThrottled
+	se.requests.Add(1)
+	switch {
+	case primaryThrottled == shadowThrottled:
+		se.agreements.Add(1)
+	case shadowThrottled:
+		se.extraThrottles.Add(1)
+	default:
+		se.missedThrottles.Add(1)
+	}
+}
+
+// ReportOutcome reports the outcome to both trackers and returns the result of
+// the primary.
+func (se *ShadowEvaluator) ReportOutcome(ctx context.Context, clientIdentifier []byte, outcome request.Outcome) *request.ReportOutcomeResult {
+	return se.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, 1)
+}
+
+// ReportOutcomeWithCost reports the outcome with a cost to both trackers and
+// returns the result of the primary.
+func (se *ShadowEvaluator) ReportOutcomeWithCost(ctx context.Context, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	se.shadow.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, cost)
+	return se.primary.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, cost)
+}
+
+// Stats returns how the decisions of the two trackers have compared so far.
+func (se *ShadowEvaluator) Stats() ShadowStats {
+	return ShadowStats{
+		Requests:        se.requests.Load(),
+		Agreements:      se.agreements.Load(),
+		ExtraThrottles:  se.extraThrottles.Load(),
+		MissedThrottles: se.missedThrottles.Load(),
+	}
+}
+
+// Close closes both trackers.
+func (se *ShadowEvaluator) Close() {
+	se.primary.Close()
+	se.shadow.Close()
+}
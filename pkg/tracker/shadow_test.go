@@ -0,0 +1,76 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+func TestShadowEvaluator(t *testing.T) {
+	newTracker := func(mode config.ThrottleMode, threshold float64) *FairnessTracker {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.Pi = 0.5
+		conf.Pd = 0.1
+		conf.Lambda = 0
+		conf.ThrottleMode = mode
+		conf.DecisionMode = config.DecisionModeThreshold
+		conf.DecisionThreshold = threshold
+		trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+		require.NoError(t, err)
+		return trk
+	}
+	// The shadow throttles at a lower probability, in shadow mode
+	evaluator := NewShadowEvaluator(newTracker(config.ThrottleModeReject, 0.9), newTracker(config.ThrottleModeShadow, 0.4))
+	defer evaluator.Close()
+	ctx := context.Background()
+	good, bad, worst := []byte("good"), []byte("bad"), []byte("worst")
+	evaluator.ReportOutcome(ctx, bad, request.OutcomeFailure)
+	evaluator.ReportOutcomeWithCost(ctx, worst, request.OutcomeFailure, 2)
+
+	require.False(t, evaluator.RegisterRequest(ctx, good).ShouldThrottle)
+	require.False(t, evaluator.RegisterRequest(ctx, bad).ShouldThrottle, "only the shadow throttles at 0.5")
+	require.True(t, evaluator.RegisterRequest(ctx, worst).ShouldThrottle)
+
+	stats := evaluator.Stats()
+	require.Equal(t, ShadowStats{Requests: 3, Agreements: 2, ExtraThrottles: 1}, stats)
+	require.InDelta(t, 2.0/3, stats.AgreementRate(), 1e-9)
+}
+
+func TestShadowEvaluator_ProbabilisticModeSharesDraws(t *testing.T) {
+	newTracker := func() *FairnessTracker {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.Pi = 0.5
+		conf.Lambda = 0
+		conf.HashSeed = 1
+		conf.MinPassRate = 0.2
+		trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+		require.NoError(t, err)
+		return trk
+	}
+	// Identical configs in the probabilistic mode
+	evaluator := NewShadowEvaluator(newTracker(), newTracker())
+	defer evaluator.Close()
+	ctx := context.Background()
+	bad := []byte("bad")
+	evaluator.ReportOutcome(ctx, bad, request.OutcomeFailure)
+
+	throttled := 0
+	for range 1000 {
+		if evaluator.RegisterRequest(ctx, bad).ShouldThrottle {
+			throttled++
+		}
+	}
+
+	require.Equal(t, ShadowStats{Requests: 1000, Agreements: 1000}, evaluator.Stats())
+	require.Greater(t, throttled, 0, "decisions must still be random")
+	require.Less(t, throttled, 1000, "decisions must still be random")
+}
+
+func TestShadowStats_AgreementRateWithoutRequests(t *testing.T) {
+	require.Equal(t, 1.0, ShadowStats{}.AgreementRate())
+}
@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"context"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/data"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
+)
+
+// RegisterTieredRequest records a request sent by a user of a tenant and
+// returns whether it should be throttled. The tenant and the user within it
+// are tracked as separate flows of the same structures, and the final
+// probability is the weighted mean of both, using TenantWeight and UserWeight
+// from the config. This way a single misbehaving user of a big tenant is
+// throttled mostly on its own instead of burning the budget of the whole
+// tenant, while a tenant whose users misbehave together is still throttled as
+// a whole. Report outcomes with ReportTieredOutcome. The rate limit applies to
+// the user, while the decision cache and pending request tracking are not
+// used. Result stats, when enabled, describe the buckets of the user.
+func (ft *FairnessTracker) RegisterTieredRequest(ctx context.Context, tenant, user []byte) *request.RegisterRequestResult {
+	resp := &request.RegisterRequestResult{}
+
+	if ft.isClosed() {
+		resp.Err = fairerrors.ErrClosed
+		return resp
+	}
+	if err := ctx.Err(); err != nil {
+		resp.Err = err
+		return resp
+	}
+
+	snapshot := ft.current.Load()
+	tenantID, userID := tieredIdentifiers(snapshot.config, tenant, user)
+	if ft.rateLimiter != nil {
+		if allowed, wait := ft.rateLimiter.take(userID); !allowed {
+			rateLimitedResult(snapshot.config, wait, resp)
+			ft.recordDecision(snapshot.config, userID, resp)
+			return resp
+		}
+	}
+
+	tenantResp := scratchResults.Get().(*request.RegisterRequestResult)
+	snapshot.generations[0].RegisterRequestInto(ctx, tenantID, tenantResp)
+	tenantProbability := tenantResp.FinalProbability
+	scratchResults.Put(tenantResp)
+
+	snapshot.generations[0].RegisterRequestInto(ctx, userID, resp)
+
+	tenantWeight, userWeight := snapshot.config.TenantWeight, snapshot.config.UserWeight
+	if tenantWeight == 0 && userWeight == 0 {
+		tenantWeight, userWeight = 1, 1
+	}
+	pFinal := (tenantWeight*tenantProbability + userWeight*resp.FinalProbability) / (tenantWeight + userWeight)
+	if resp.ResultStats != nil {
+		resp.ResultStats.FinalProbability = pFinal
+	}
+	data.Decide(snapshot.config, ft.adjustProbability(snapshot.config, pFinal, request.PriorityNormal), resp)
+	ft.recordDecision(snapshot.config, userID, resp)
+
+	return resp
+}
+
+// ReportTieredOutcome reports the outcome of a request registered with
+// RegisterTieredRequest to both the tenant and the user.
+func (ft *FairnessTracker) ReportTieredOutcome(ctx context.Context, tenant, user []byte, outcome request.Outcome) *request.ReportOutcomeResult {
+	return ft.ReportTieredOutcomeWithCost(ctx, tenant, user, outcome, 1)
+}
+
+// ReportTieredOutcomeWithCost works like ReportTieredOutcome but scales the
+// effect of the outcome by its cost.
+func (ft *FairnessTracker) ReportTieredOutcomeWithCost(ctx context.Context, tenant, user []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	snapshot := ft.current.Load()
+	tenantID, userID := tieredIdentifiers(snapshot.config, tenant, user)
+	if resp := ft.reportOutcome(ctx, snapshot, tenantID, outcome, cost); resp.Err != nil {
+		return resp
+	}
+	return ft.reportOutcome(ctx, snapshot, userID, outcome, cost)
+}
+
+// The identifiers of the tenant and user flows. Both are composite so they
+// never collide with each other. A plain client identifier equal to their
+// encoding shares their flow, so don't mix tiered and plain identifiers from
+// untrusted sources in one tracker. The tenant and the user are normalized
+// separately, since normalizers could otherwise rewrite the length prefixes.
+func tieredIdentifiers(conf *config.FairnessTrackerConfig, tenant, user []byte) ([]byte, []byte) {
+	tenant, user = normalizeIdentifier(conf, tenant), normalizeIdentifier(conf, user)
+	return request.CompositeID(tenant), request.CompositeID(tenant, user)
+}
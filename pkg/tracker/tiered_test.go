@@ -0,0 +1,80 @@
+package tracker
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
+	"github.com/satmihir/fair/pkg/utils"
+)
+
+func TestRegisterTieredRequest(t *testing.T) {
+	newTracker := func(tenantWeight, userWeight float64) *FairnessTracker {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.Pi = 0.5
+		conf.Pd = 0.1
+		conf.Lambda = 0
+		conf.DecisionMode = config.DecisionModeDefer
+		conf.TenantWeight = tenantWeight
+		conf.UserWeight = userWeight
+		trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+		require.NoError(t, err)
+		return trk
+	}
+	ctx := context.Background()
+	tenant, otherTenant := []byte("tenant"), []byte("other-tenant")
+	bad, good := []byte("bad"), []byte("good")
+
+	cases := []struct {
+		name                string
+		tenantWeight        float64
+		userWeight          float64
+		expectedForSameGood float64
+	}{
+		{name: "equal weights by default", expectedForSameGood: 0.5},
+		{name: "mostly the user", tenantWeight: 1, userWeight: 3, expectedForSameGood: 0.25},
+		{name: "only the user", userWeight: 1, expectedForSameGood: 0},
+		{name: "only the tenant", tenantWeight: 1, expectedForSameGood: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			trk := newTracker(tc.tenantWeight, tc.userWeight)
+			defer trk.Close()
+			for range 2 {
+				require.NoError(t, trk.ReportTieredOutcome(ctx, tenant, bad, request.OutcomeFailure).Err)
+			}
+
+			require.InDelta(t, 1, trk.RegisterTieredRequest(ctx, tenant, bad).FinalProbability, 1e-9)
+			require.InDelta(t, tc.expectedForSameGood, trk.RegisterTieredRequest(ctx, tenant, good).FinalProbability, 1e-9)
+			require.Zero(t, trk.RegisterTieredRequest(ctx, otherTenant, bad).FinalProbability, "other tenants are spared")
+			require.Zero(t, trk.RegisterRequest(ctx, tenant).FinalProbability, "tiered flows don't collide with plain identifiers")
+		})
+	}
+}
+
+func TestRegisterTieredRequest_Closed(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	trk.Close()
+	ctx := context.Background()
+
+	require.ErrorIs(t, trk.RegisterTieredRequest(ctx, []byte("tenant"), []byte("user")).Err, fairerrors.ErrClosed)
+	require.ErrorIs(t, trk.ReportTieredOutcome(ctx, []byte("tenant"), []byte("user"), request.OutcomeFailure).Err, fairerrors.ErrClosed)
+}
+
+func TestNewFairnessTracker_InvalidTierWeights(t *testing.T) {
+	for _, weights := range [][2]float64{{-1, 1}, {1, -1}, {math.NaN(), 1}, {1, math.Inf(1)}} {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.TenantWeight = weights[0]
+		conf.UserWeight = weights[1]
+
+		_, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+
+		require.ErrorIs(t, err, fairerrors.ErrInvalidConfig, "weights: %v", weights)
+	}
+}
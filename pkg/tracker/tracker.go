@@ -2,10 +2,17 @@ package tracker
 
 import (
 	"context"
+	"maps"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/satmihir/fair/pkg/config"
 	"github.com/satmihir/fair/pkg/data"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/identity"
 	"github.com/satmihir/fair/pkg/logger"
 	"github.com/satmihir/fair/pkg/request"
 	"github.com/satmihir/fair/pkg/utils"
@@ -15,23 +22,83 @@ import (
 // client flows and determines when a request should be throttled to maintain
 // fairness.
 type FairnessTracker struct {
-	trackerConfig *config.FairnessTrackerConfig
+	// The config and the structures in use. Requests load it without taking
+	// any lock, while rotations and config changes publish a new one.
+	current atomic.Pointer[trackerSnapshot]
 
 	// A counter to uniquely identify a structure
 	structureIDCounter uint64
 
-	mainStructure      request.Tracker
-	secondaryStructure request.Tracker
-
+	clock  utils.IClock
 	ticker utils.ITicker
 
-	// Rotation lock to ensure that we don't rotate while updating the structures
-	// The act of updating is a "read" in this case since multiple updates can happen
-	// concurrently, but none can happen while we are rotating so that's a write.
-	rotationLock sync.RWMutex
+	// Sketch of the clients receiving the most throttle decisions. Nil when
+	// disabled in the config.
+	topThrottled *data.HeavyHitters
+
+	// Per-client token buckets enforcing MaxRPS. Nil when disabled in the config.
+	rateLimiter *rateLimiter
+
+	// Recent final probabilities of hot clients. Nil when disabled in the config.
+	decisionCache *decisionCache
+
+	// Recent clients of shared resources. Nil when disabled in the config.
+	resourceAccess *resourceAccess
+
+	// Admitted requests waiting for their outcome. Nil when disabled in the
+	// config.
+	pendingRequests *pendingRequests
+
+	// Hashes client identifiers before they are exposed. Nil unless the
+	// privacy mode is enabled in the config.
+	privateIdentifier identity.Normalizer
+
+	// Serializes rotations and config changes, which derive the next snapshot
+	// from the current one
+	updateLock   sync.Mutex
 	stopRotation chan struct{}
+
+	// The lifecycle state of the tracker
+	state atomic.Int32
+
+	// Counters reported by GetStats
+	requests  atomic.Uint64
+	throttles atomic.Uint64
+	reports   atomic.Uint64
+	// When the rotation ticker last fired or was reset, in Unix nanoseconds
+	lastRotation atomic.Int64
+
+	// The bits of the factor scaling final probabilities with the saturation of
+	// the protected resource
+	overloadFactor atomic.Uint64
 }
 
+// An immutable pair of a config and the structures built with it. Requests
+// keep working on the snapshot they loaded even if a newer one is published
+// meanwhile, which at worst updates a structure that was just retired.
+type trackerSnapshot struct {
+	config *config.FairnessTrackerConfig
+
+	// The structures in rotation order. The first one makes the decisions and
+	// the rest are warming up to take over after the following rotations.
+	generations []request.Tracker
+}
+
+// The lifecycle states of a tracker. A tracker starts running and moves to
+// closed exactly once.
+const (
+	stateRunning int32 = iota
+	stateClosed
+)
+
+const (
+	// The number of structures in rotation when NumGenerations is not set
+	defaultNumGenerations = 2
+	// The factor by which the weight of outcomes shrinks from one future
+	// generation to the next
+	futureGenerationWeightDecay = 0.5
+)
+
 var newTrackerStructureWithClock = func(
 	trackerConfig *config.FairnessTrackerConfig,
 	id uint64,
@@ -41,41 +108,110 @@ var newTrackerStructureWithClock = func(
 	return data.NewStructureWithClock(trackerConfig, id, includeStats, clock)
 }
 
+var newResizedTrackerStructure = func(
+	trackerConfig *config.FairnessTrackerConfig,
+	from request.Tracker,
+	clock utils.IClock,
+) (request.Tracker, error) {
+	structure, ok := from.(*data.Structure)
+	if !ok {
+		// There's no state we know how to carry over
+		return newTrackerStructureWithClock(trackerConfig, from.GetID(), trackerConfig.IncludeStats, clock)
+	}
+	return data.NewResizedStructure(trackerConfig, structure, clock)
+}
+
 // NewFairnessTrackerWithClockAndTicker creates a FairnessTracker using the
 // provided clock and ticker. It is primarily used for tests and simulations
-// where time needs to be controlled.
+// where time needs to be controlled. A nil clock falls back to the real
+// system clock.
 func NewFairnessTrackerWithClockAndTicker(trackerConfig *config.FairnessTrackerConfig, clock utils.IClock, ticker utils.ITicker) (*FairnessTracker, error) {
 	// Guard clause: fail fast and return a clear error when caller passes a nil config.
 	// Without this, the function dereferences fields on trackerConfig (e.g. trackerConfig.IncludeStats)
 	// below and will panic with "runtime error: invalid memory address or nil pointer dereference".
 	if trackerConfig == nil {
-		return nil, NewFairnessTrackerError(nil, "trackerConfig must not be nil")
+		return nil, NewFairnessTrackerError(nil, "trackerConfig must not be nil").WithSentinel(fairerrors.ErrNilConfig)
 	}
-	st1, err := newTrackerStructureWithClock(trackerConfig, 1, trackerConfig.IncludeStats, clock)
-	if err != nil {
-		logger.Printf("error in creating first tracker : %v", err)
-		return nil, NewFairnessTrackerError(err, "Failed to create a structure")
+	if clock == nil {
+		clock = utils.NewRealClock()
 	}
+	// Keep a private copy so ApplyConfig can update tunables without touching
+	// the caller's struct
+	configCopy := *trackerConfig
+	configCopy.PriorityMultipliers = maps.Clone(configCopy.PriorityMultipliers)
+	configCopy.OutcomeMultipliers = maps.Clone(configCopy.OutcomeMultipliers)
+	trackerConfig = &configCopy
 
-	st2, err := newTrackerStructureWithClock(trackerConfig, 2, trackerConfig.IncludeStats, clock)
-	if err != nil {
-		logger.Printf("error in creating second tracker : %v", err)
-		return nil, NewFairnessTrackerError(err, "Failed to create a structure")
+	if err := validateTrackerConfig(trackerConfig); err != nil {
+		return nil, err
+	}
+	numGenerations := trackerConfig.NumGenerations
+	if numGenerations == 0 {
+		numGenerations = defaultNumGenerations
+	}
+
+	generations := make([]request.Tracker, numGenerations)
+	for i := range generations {
+		id := uint64(i + 1)
+		st, err := newTrackerStructureWithClock(trackerConfig, id, trackerConfig.IncludeStats, clock)
+		if err != nil {
+			logger.Error("failed to create structure", "id", id, "error", err)
+			return nil, NewFairnessTrackerError(err, "Failed to create a structure").WithSentinel(fairerrors.ErrStructureCreation)
+		}
+		generations[i] = st
+	}
+
+	var topThrottled *data.HeavyHitters
+	if trackerConfig.TopThrottledClientsCapacity > 0 {
+		topThrottled = data.NewHeavyHitters(int(trackerConfig.TopThrottledClientsCapacity))
+	}
+
+	var limiter *rateLimiter
+	if trackerConfig.MaxRPS > 0 {
+		limiter = newRateLimiter(trackerConfig.MaxRPS, trackerConfig.Burst, clock)
+	}
+
+	var cache *decisionCache
+	if trackerConfig.DecisionCacheSize > 0 {
+		cache = newDecisionCache(int(trackerConfig.DecisionCacheSize), trackerConfig.DecisionCacheTTL, clock)
+	}
+
+	var resources *resourceAccess
+	if trackerConfig.ResourceBlastRadius > 0 {
+		resources = newResourceAccess(int(trackerConfig.ResourceBlastRadius))
+	}
+
+	var pending *pendingRequests
+	if trackerConfig.PendingRequestTTL > 0 {
+		pending = newPendingRequests(trackerConfig.PendingRequestTTL, clock)
+	}
+
+	var privateIdentifier identity.Normalizer
+	if len(trackerConfig.PrivacySalt) > 0 {
+		privateIdentifier = identity.HMAC(trackerConfig.PrivacySalt)
 	}
 
 	stopRotation := make(chan struct{})
 	ft := &FairnessTracker{
-		trackerConfig:      trackerConfig,
-		structureIDCounter: 3,
-
-		mainStructure:      st1,
-		secondaryStructure: st2,
+		structureIDCounter: uint64(numGenerations) + 1,
 
+		clock:  clock,
 		ticker: ticker,
 
-		rotationLock: sync.RWMutex{},
+		topThrottled:  topThrottled,
+		rateLimiter:   limiter,
+		decisionCache: cache,
+
+		resourceAccess: resources,
+
+		pendingRequests:   pending,
+		privateIdentifier: privateIdentifier,
+
 		stopRotation: stopRotation,
 	}
+	ft.current.Store(&trackerSnapshot{config: trackerConfig, generations: generations})
+	ft.overloadFactor.Store(math.Float64bits(1))
+	ft.lastRotation.Store(clock.Now().UnixNano())
 
 	// Start a periodic task to rotate underlying structures to keep
 	// changing the hash seeds so we don't continue punishing the same
@@ -86,66 +222,684 @@ func NewFairnessTrackerWithClockAndTicker(trackerConfig *config.FairnessTrackerC
 			case <-stopRotation:
 				return
 			case <-ticker.C():
-				s, err := newTrackerStructureWithClock(trackerConfig, ft.structureIDCounter, trackerConfig.IncludeStats, clock)
+				ft.updateLock.Lock()
+				current := ft.current.Load()
+				s, err := newTrackerStructureWithClock(current.config, ft.structureIDCounter, current.config.IncludeStats, clock)
 				if err != nil {
+					ft.updateLock.Unlock()
 					logger.Fatalf("failed to create a structure during rotation: %v", err)
 					return
 				}
 				ft.structureIDCounter++
 
-				ft.rotationLock.Lock()
-				ft.mainStructure = ft.secondaryStructure
-				ft.secondaryStructure = s
-				ft.rotationLock.Unlock()
+				generations := make([]request.Tracker, len(current.generations))
+				copy(generations, current.generations[1:])
+				generations[len(generations)-1] = s
+				ft.current.Store(&trackerSnapshot{config: current.config, generations: generations})
+				ft.lastRotation.Store(clock.Now().UnixNano())
+				ft.updateLock.Unlock()
+
+				retired := current.generations[0]
+				logger.Info("rotated structures", "main_id", generations[0].GetID(), "newest_id", s.GetID())
+
+				if ft.rateLimiter != nil {
+					ft.rateLimiter.prune()
+				}
+				if ft.decisionCache != nil {
+					ft.decisionCache.clear()
+				}
+				if ft.resourceAccess != nil {
+					ft.resourceAccess.clear()
+				}
+				if ft.pendingRequests != nil {
+					// Time out pending requests even when no requests arrive
+					ft.expirePendingRequests(ft.current.Load())
+				}
+				if current.config.Observer != nil {
+					current.config.Observer.OnRotation(retired.GetID(), s.GetID())
+				}
 			}
 		}
 	}()
 	return ft, nil
 }
 
+// Check the fields of the config the tracker uses on top of the structures
+func validateTrackerConfig(trackerConfig *config.FairnessTrackerConfig) error {
+	if !(trackerConfig.MaxRPS >= 0) {
+		return NewFairnessTrackerError(nil, "MaxRPS must not be negative, found: %f", trackerConfig.MaxRPS).
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if trackerConfig.LatencyLimit != 0 && !(0 <= trackerConfig.LatencyTarget && trackerConfig.LatencyTarget < trackerConfig.LatencyLimit) {
+		return NewFairnessTrackerError(nil, "LatencyTarget must be in [0, LatencyLimit), found LatencyTarget: %v and LatencyLimit: %v",
+			trackerConfig.LatencyTarget, trackerConfig.LatencyLimit).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if !(trackerConfig.TenantWeight >= 0) || math.IsInf(trackerConfig.TenantWeight, 0) ||
+		!(trackerConfig.UserWeight >= 0) || math.IsInf(trackerConfig.UserWeight, 0) {
+		return NewFairnessTrackerError(nil, "TenantWeight and UserWeight must be finite and not negative, found TenantWeight: %f and UserWeight: %f",
+			trackerConfig.TenantWeight, trackerConfig.UserWeight).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if trackerConfig.PendingRequestTTL < 0 {
+		return NewFairnessTrackerError(nil, "PendingRequestTTL must not be negative, found: %v",
+			trackerConfig.PendingRequestTTL).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if trackerConfig.DecisionCacheSize > 0 && trackerConfig.DecisionCacheTTL <= 0 {
+		return NewFairnessTrackerError(nil, "DecisionCacheTTL must be positive when the decision cache is enabled, found: %v",
+			trackerConfig.DecisionCacheTTL).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if trackerConfig.NumGenerations == 1 {
+		return NewFairnessTrackerError(nil, "NumGenerations must be at least 2, found: %d", trackerConfig.NumGenerations).
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	return nil
+}
+
 // NewFairnessTracker creates a FairnessTracker using the real system clock and
 // ticker.
 func NewFairnessTracker(trackerConfig *config.FairnessTrackerConfig) (*FairnessTracker, error) {
 	if trackerConfig == nil {
-		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil")
+		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
+	}
+	if err := validateConfigForRealTicker(trackerConfig); err != nil {
+		return nil, err
 	}
 	clk := utils.NewRealClock()
 	ticker := utils.NewRealTicker(trackerConfig.RotationFrequency)
 	return NewFairnessTrackerWithClockAndTicker(trackerConfig, clk, ticker)
 }
 
+// Check the whole config before a real ticker is created from it, since the
+// ticker panics on a RotationFrequency that isn't positive
+func validateConfigForRealTicker(trackerConfig *config.FairnessTrackerConfig) error {
+	if trackerConfig.RotationFrequency <= 0 {
+		return NewFairnessTrackerError(nil, "RotationFrequency must be positive, found: %v",
+			trackerConfig.RotationFrequency).WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	if err := data.ValidateConfig(trackerConfig); err != nil {
+		return err
+	}
+	return validateTrackerConfig(trackerConfig)
+}
+
+// Shared results of failed reports, returned instead of allocating
+var (
+	closedReportResult       = &request.ReportOutcomeResult{Err: fairerrors.ErrClosed}
+	unknownTokenReportResult = &request.ReportOutcomeResult{Err: fairerrors.ErrUnknownToken}
+)
+
+// Scratch results for registrations whose decisions are discarded
+var scratchResults = sync.Pool{
+	New: func() any {
+		return new(request.RegisterRequestResult)
+	},
+}
+
 // RegisterRequest records an incoming request and returns whether it should be
 // throttled.
 func (ft *FairnessTracker) RegisterRequest(ctx context.Context, clientIdentifier []byte) *request.RegisterRequestResult {
-	// We must take the rotation lock to avoid rotation while updating the structures
-	ft.rotationLock.RLock()
-	defer ft.rotationLock.RUnlock()
-
-	resp := ft.mainStructure.RegisterRequest(ctx, clientIdentifier)
+	resp := &request.RegisterRequestResult{}
+	ft.RegisterRequestInto(ctx, clientIdentifier, resp)
+	return resp
+}
 
-	// To keep the bad workloads data "warm" in the rotated structure, we will update both
-	ft.secondaryStructure.RegisterRequest(ctx, clientIdentifier)
+// RegisterRequestInto works like RegisterRequest but writes the decision into
+// the given result, overwriting its previous contents. Callers on hot paths can
+// reuse results to avoid allocating per request.
+func (ft *FairnessTracker) RegisterRequestInto(ctx context.Context, clientIdentifier []byte, resp *request.RegisterRequestResult) {
+	ft.registerRequest(ctx, ft.current.Load(), clientIdentifier, request.PriorityNormal, nil, resp)
+}
 
+// RegisterRequestWithPriority works like RegisterRequest for a request of the
+// given priority. The final probability is scaled by the multiplier configured
+// for the priority in PriorityMultipliers, capped at 1. Outcomes are reported
+// as usual, since a client's flow is shared by all of its priorities.
+func (ft *FairnessTracker) RegisterRequestWithPriority(ctx context.Context, clientIdentifier []byte, priority request.Priority) *request.RegisterRequestResult {
+	resp := &request.RegisterRequestResult{}
+	ft.registerRequest(ctx, ft.current.Load(), clientIdentifier, priority, nil, resp)
 	return resp
 }
 
+// Register a single request with the structures of the given snapshot. The
+// decision is based on the given draws, or on fresh ones if they are nil.
+func (ft *FairnessTracker) registerRequest(ctx context.Context, snapshot *trackerSnapshot, clientIdentifier []byte, priority request.Priority, draws *data.Draws, resp *request.RegisterRequestResult) {
+	if ft.isClosed() {
+		*resp = request.RegisterRequestResult{Err: fairerrors.ErrClosed}
+		return
+	}
+	// Don't spend any work on a request the caller has already given up on
+	if err := ctx.Err(); err != nil {
+		*resp = request.RegisterRequestResult{Err: err}
+		return
+	}
+
+	clientIdentifier = normalizeIdentifier(snapshot.config, clientIdentifier)
+
+	if ft.rateLimiter != nil {
+		if allowed, wait := ft.rateLimiter.take(clientIdentifier); !allowed {
+			rateLimitedResult(snapshot.config, wait, resp)
+			ft.trackPendingRequest(snapshot, clientIdentifier, resp)
+			ft.recordDecision(snapshot.config, clientIdentifier, resp)
+			return
+		}
+	}
+
+	if ft.decisionCache != nil {
+		if probability, stats, ok := ft.decisionCache.get(clientIdentifier); ok {
+			*resp = request.RegisterRequestResult{ResultStats: stats}
+			decide(snapshot.config, ft.adjustProbability(snapshot.config, probability, priority), draws, resp)
+			ft.trackPendingRequest(snapshot, clientIdentifier, resp)
+			ft.recordDecision(snapshot.config, clientIdentifier, resp)
+			return
+		}
+	}
+
+	// Registering only reads the buckets, so only the main generation is asked
+	snapshot.generations[0].RegisterRequestInto(ctx, clientIdentifier, resp)
+
+	if ft.decisionCache != nil {
+		ft.decisionCache.put(clientIdentifier, resp.FinalProbability, resp.ResultStats)
+	}
+	if adjusted := ft.adjustProbability(snapshot.config, resp.FinalProbability, priority); adjusted != resp.FinalProbability || draws != nil {
+		decide(snapshot.config, adjusted, draws, resp)
+	}
+	ft.trackPendingRequest(snapshot, clientIdentifier, resp)
+	ft.recordDecision(snapshot.config, clientIdentifier, resp)
+}
+
+// Decide with the given draws, or with fresh ones if they are nil
+func decide(conf *config.FairnessTrackerConfig, pFinal float64, draws *data.Draws, resp *request.RegisterRequestResult) {
+	if draws == nil {
+		data.Decide(conf, pFinal, resp)
+		return
+	}
+	data.DecideWithDraws(conf, pFinal, *draws, resp)
+}
+
+// Issue a token for an admitted request and time out the pending requests
+// whose TTL has passed. It does nothing unless PendingRequestTTL is set.
+func (ft *FairnessTracker) trackPendingRequest(snapshot *trackerSnapshot, clientIdentifier []byte, resp *request.RegisterRequestResult) {
+	if ft.pendingRequests == nil {
+		return
+	}
+
+	ft.expirePendingRequests(snapshot)
+	if !resp.ShouldThrottle {
+		resp.Token = ft.pendingRequests.add(clientIdentifier)
+	}
+}
+
+// Report the pending requests whose TTL has passed as timeouts
+func (ft *FairnessTracker) expirePendingRequests(snapshot *trackerSnapshot) {
+	for _, clientIdentifier := range ft.pendingRequests.expire() {
+		// The timeouts don't belong to the caller's request, so they must not
+		// be dropped when its context is done
+		ft.reportOutcome(context.Background(), snapshot, clientIdentifier, request.OutcomeTimeout, 1)
+	}
+}
+
+// Fill in the result for a request rejected by the rate limiter, honoring the
+// configured throttle mode
+func rateLimitedResult(conf *config.FairnessTrackerConfig, wait time.Duration, resp *request.RegisterRequestResult) {
+	*resp = request.RegisterRequestResult{RateLimited: true}
+
+	switch conf.ThrottleMode {
+	case config.ThrottleModeShadow:
+		resp.ShadowThrottled = true
+	case config.ThrottleModeDelay:
+		resp.ShouldThrottle = true
+		resp.RetryAfter = wait
+	default:
+		resp.ShouldThrottle = true
+	}
+}
+
 // ReportOutcome updates the trackers with the outcome of the request from the
 // given client identifier.
 func (ft *FairnessTracker) ReportOutcome(ctx context.Context, clientIdentifier []byte, outcome request.Outcome) *request.ReportOutcomeResult {
-	// We must take the rotation lock to avoid rotation while updating the structures
-	ft.rotationLock.RLock()
-	defer ft.rotationLock.RUnlock()
+	return ft.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, 1)
+}
 
-	resp := ft.mainStructure.ReportOutcome(ctx, clientIdentifier, outcome)
+// ReportOutcomeWithCost updates the trackers with the outcome of a request
+// whose effect is scaled by its cost. Use it when requests consume very
+// different amounts of the resource.
+func (ft *FairnessTracker) ReportOutcomeWithCost(ctx context.Context, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	snapshot := ft.current.Load()
+	return ft.reportOutcome(ctx, snapshot, normalizeIdentifier(snapshot.config, clientIdentifier), outcome, cost)
+}
 
-	// To keep the bad workloads data "warm" in the rotated structure, we will update both
-	ft.secondaryStructure.ReportOutcome(ctx, clientIdentifier, outcome)
+// Rewrite a client identifier with the normalizer of the config, if any
+func normalizeIdentifier(conf *config.FairnessTrackerConfig, clientIdentifier []byte) []byte {
+	if conf.IdentifierNormalizer == nil {
+		return clientIdentifier
+	}
+	return conf.IdentifierNormalizer(clientIdentifier)
+}
+
+// Report an outcome to every generation of the given snapshot. The client
+// identifier must already be normalized.
+func (ft *FairnessTracker) reportOutcome(ctx context.Context, snapshot *trackerSnapshot, clientIdentifier []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	if ft.isClosed() {
+		return closedReportResult
+	}
+
+	ft.reports.Add(1)
+	resp := snapshot.generations[0].ReportOutcomeWithCost(ctx, clientIdentifier, outcome, cost)
+
+	// To keep the bad workloads data "warm" in the rotated structures, we will
+	// update all of them. Generations further from taking over get less weight,
+	// so they hold a softer copy of the recent history.
+	weight := 1.0
+	for _, future := range snapshot.generations[1:] {
+		future.ReportOutcomeWithCost(ctx, clientIdentifier, outcome, cost*weight)
+		weight *= futureGenerationWeightDecay
+	}
 
 	return resp
 }
 
+// ReportOutcomeByToken reports the outcome of a request using the token
+// returned when it was registered, and stops tracking it as pending. It
+// returns an error matching fairerrors.ErrUnknownToken if the token was
+// already reported or timed out, or if PendingRequestTTL is not set.
+func (ft *FairnessTracker) ReportOutcomeByToken(ctx context.Context, token uint64, outcome request.Outcome) *request.ReportOutcomeResult {
+	if ft.isClosed() {
+		return closedReportResult
+	}
+	if ft.pendingRequests == nil {
+		return unknownTokenReportResult
+	}
+
+	clientIdentifier, ok := ft.pendingRequests.take(token)
+	if !ok {
+		return unknownTokenReportResult
+	}
+	return ft.reportOutcome(ctx, ft.current.Load(), clientIdentifier, outcome, 1)
+}
+
+// GetInFlightCount returns the number of admitted requests of the given client
+// whose outcome hasn't been reported by token or timed out yet. It returns 0
+// unless PendingRequestTTL is set in the config.
+func (ft *FairnessTracker) GetInFlightCount(clientIdentifier []byte) int {
+	if ft.pendingRequests == nil {
+		return 0
+	}
+	return ft.pendingRequests.count(normalizeIdentifier(ft.current.Load().config, clientIdentifier))
+}
+
+// ReportLatency infers the outcome of a request from its latency, for systems
+// where contention shows up as slowness rather than errors. Latencies at or
+// below LatencyTarget are reported as successes, latencies at or above
+// LatencyLimit as failures, and latencies in between as failures with a cost
+// that grows linearly from 0 to 1. It does nothing unless LatencyLimit is set
+// in the config.
+func (ft *FairnessTracker) ReportLatency(ctx context.Context, clientIdentifier []byte, latency time.Duration) *request.ReportOutcomeResult {
+	if ft.isClosed() {
+		return closedReportResult
+	}
+	snapshot := ft.current.Load()
+	target, limit := snapshot.config.LatencyTarget, snapshot.config.LatencyLimit
+	if limit == 0 {
+		return request.ReportOutcomeOK
+	}
+
+	outcome, cost := request.OutcomeFailure, 1.0
+	if latency <= target {
+		outcome = request.OutcomeSuccess
+	} else if latency < limit {
+		cost = float64(latency-target) / float64(limit-target)
+	}
+
+	return ft.reportOutcome(ctx, snapshot, normalizeIdentifier(snapshot.config, clientIdentifier), outcome, cost)
+}
+
+// RecordResourceAccess notes that the given client accessed a shared resource,
+// such as a database shard or a downstream dependency, so outcomes later
+// reported against the resource with ReportResourceOutcome can be attributed
+// to it. Accesses are forgotten on rotation. It does nothing unless
+// ResourceBlastRadius is set in the config.
+func (ft *FairnessTracker) RecordResourceAccess(clientIdentifier []byte, resourceKey []byte) {
+	if ft.resourceAccess == nil || ft.isClosed() {
+		return
+	}
+	ft.resourceAccess.record(resourceKey, normalizeIdentifier(ft.current.Load().config, clientIdentifier))
+}
+
+// ReportResourceOutcome reports the outcome of a shared resource instead of a
+// single client. The outcome is split among the heaviest recent clients of
+// the resource in proportion to their share of its recent accesses, so a
+// client that merely happened to see a failure caused by others takes little
+// of the blame. Clients that didn't access the resource are never penalized.
+// It does nothing unless ResourceBlastRadius is set in the config.
+func (ft *FairnessTracker) ReportResourceOutcome(ctx context.Context, resourceKey []byte, outcome request.Outcome) *request.ReportOutcomeResult {
+	if ft.isClosed() {
+		return closedReportResult
+	}
+	if ft.resourceAccess == nil {
+		return request.ReportOutcomeOK
+	}
+
+	accessors := ft.resourceAccess.accessors(resourceKey)
+	var total uint64
+	for _, accessor := range accessors {
+		total += accessor.Count
+	}
+	snapshot := ft.current.Load()
+	for _, accessor := range accessors {
+		ft.reportOutcome(ctx, snapshot, accessor.Key, outcome, float64(accessor.Count)/float64(total))
+	}
+
+	return request.ReportOutcomeOK
+}
+
+// RegisterRequests records a batch of incoming requests and returns the
+// throttling decision for each of them in the same order. All decisions are
+// made against the same structures, even if they rotate during the batch.
+func (ft *FairnessTracker) RegisterRequests(ctx context.Context, clientIdentifiers [][]byte) []*request.RegisterRequestResult {
+	results := make([]*request.RegisterRequestResult, len(clientIdentifiers))
+
+	snapshot := ft.current.Load()
+	for i, clientIdentifier := range clientIdentifiers {
+		results[i] = &request.RegisterRequestResult{}
+		ft.registerRequest(ctx, snapshot, clientIdentifier, request.PriorityNormal, nil, results[i])
+	}
+
+	return results
+}
+
+// ReportOutcomes updates the trackers with a batch of outcomes and returns a
+// result for each report in the same order. All outcomes are reported to the
+// same structures, even if they rotate during the batch.
+func (ft *FairnessTracker) ReportOutcomes(ctx context.Context, reports []request.OutcomeReport) []*request.ReportOutcomeResult {
+	results := make([]*request.ReportOutcomeResult, len(reports))
+
+	snapshot := ft.current.Load()
+	for i, report := range reports {
+		results[i] = ft.reportOutcome(ctx, snapshot, normalizeIdentifier(snapshot.config, report.ClientIdentifier), report.Outcome, 1)
+	}
+
+	return results
+}
+
+// ApplyConfig updates the tunables of a running tracker from the given config:
+// Pi, Pd, Lambda, RotationFrequency, DecisionMode, DecisionThreshold,
+// MinPassRate, ThrottleMode, MaxRetryAfter and PriorityMultipliers. All other
+// fields, including the structure geometry, are ignored since changing them
+// requires rebuilding the structures. The update is validated first and
+// published atomically, so every request sees either the previous or the new
+// tunables. A changed RotationFrequency restarts the rotation ticker with the
+// new period.
+func (ft *FairnessTracker) ApplyConfig(newConfig *config.FairnessTrackerConfig) error {
+	if ft.isClosed() {
+		return NewFairnessTrackerError(nil, "Cannot apply a config to a closed tracker").WithSentinel(fairerrors.ErrClosed)
+	}
+	if newConfig == nil {
+		return NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
+	}
+	if newConfig.RotationFrequency <= 0 {
+		return NewFairnessTrackerError(nil, "RotationFrequency must be positive, found: %v", newConfig.RotationFrequency).
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+
+	ft.updateLock.Lock()
+	defer ft.updateLock.Unlock()
+
+	current := ft.current.Load()
+	candidate := *current.config
+	candidate.Pi = newConfig.Pi
+	candidate.Pd = newConfig.Pd
+	candidate.Lambda = newConfig.Lambda
+	candidate.RotationFrequency = newConfig.RotationFrequency
+	candidate.DecisionMode = newConfig.DecisionMode
+	candidate.DecisionThreshold = newConfig.DecisionThreshold
+	candidate.MinPassRate = newConfig.MinPassRate
+	candidate.ThrottleMode = newConfig.ThrottleMode
+	candidate.MaxRetryAfter = newConfig.MaxRetryAfter
+	candidate.PriorityMultipliers = maps.Clone(newConfig.PriorityMultipliers)
+
+	if err := data.ValidateConfig(&candidate); err != nil {
+		return NewFairnessTrackerError(err, "Invalid configuration").WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+
+	// The structures read the tunables from their config, so they are
+	// republished with the new one
+	generations := make([]request.Tracker, len(current.generations))
+	for i, generation := range current.generations {
+		if structure, ok := generation.(*data.Structure); ok {
+			generation = structure.WithConfig(&candidate)
+		}
+		generations[i] = generation
+	}
+	ft.current.Store(&trackerSnapshot{config: &candidate, generations: generations})
+
+	if candidate.RotationFrequency != current.config.RotationFrequency {
+		ft.ticker.Reset(candidate.RotationFrequency)
+		ft.lastRotation.Store(ft.clock.Now().UnixNano())
+	}
+
+	logger.Info("applied config", "pi", candidate.Pi, "pd", candidate.Pd, "lambda", candidate.Lambda,
+		"rotation_frequency", candidate.RotationFrequency, "throttle_mode", candidate.ThrottleMode)
+	return nil
+}
+
+// SetOverloadFactor scales the final probability of every request by the given
+// factor, capped at 1, to reflect how saturated the protected resource is.
+// Feed it from a signal such as CPU usage or queue depth, sampled at the
+// cadence of your choice: a factor below 1 softens throttling while the
+// resource has headroom and a factor above 1 throttles offenders harder when
+// it's stressed. Well-behaved clients with a final probability of 0 are never
+// affected. The factor starts at 1. It returns an error matching
+// fairerrors.ErrInvalidConfig if the factor is negative or not finite.
+// Result stats keep the final probability before scaling.
+func (ft *FairnessTracker) SetOverloadFactor(factor float64) error {
+	if !(factor >= 0) || math.IsInf(factor, 0) {
+		return NewFairnessTrackerError(nil, "The overload factor must be finite and not negative, found: %f", factor).
+			WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+	ft.overloadFactor.Store(math.Float64bits(factor))
+	return nil
+}
+
+// GetOverloadFactor returns the factor set with SetOverloadFactor.
+func (ft *FairnessTracker) GetOverloadFactor() float64 {
+	return math.Float64frombits(ft.overloadFactor.Load())
+}
+
+// Scale a final probability by the overload factor and the multiplier of the
+// priority of the request
+func (ft *FairnessTracker) adjustProbability(conf *config.FairnessTrackerConfig, pFinal float64, priority request.Priority) float64 {
+	factor := ft.GetOverloadFactor()
+	if multiplier, ok := conf.PriorityMultipliers[priority]; ok {
+		factor *= multiplier
+	}
+	if factor == 1 {
+		return pFinal
+	}
+	return min(1, pFinal*factor)
+}
+
+// ResizeTo rebuilds the structures with the M and L of the given config while
+// carrying over their state, so tuning the geometry doesn't cause a fairness
+// blackout. All other fields are ignored; use ApplyConfig for them. The state
+// is projected on a best-effort basis as described in data.NewResizedStructure,
+// and it is exact when the new M is a multiple of the current one and L
+// doesn't grow. The current structures keep serving requests while the new
+// ones are built, and outcomes reported in the meantime are not carried over.
+func (ft *FairnessTracker) ResizeTo(newConfig *config.FairnessTrackerConfig) error {
+	if ft.isClosed() {
+		return NewFairnessTrackerError(nil, "Cannot resize a closed tracker").WithSentinel(fairerrors.ErrClosed)
+	}
+	if newConfig == nil {
+		return NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
+	}
+
+	ft.updateLock.Lock()
+	defer ft.updateLock.Unlock()
+
+	current := ft.current.Load()
+	previous := current.config
+	candidate := *previous
+	candidate.M = newConfig.M
+	candidate.L = newConfig.L
+	if err := data.ValidateConfig(&candidate); err != nil {
+		return NewFairnessTrackerError(err, "Invalid configuration").WithSentinel(fairerrors.ErrInvalidConfig)
+	}
+
+	resized := make([]request.Tracker, len(current.generations))
+	for i, generation := range current.generations {
+		st, err := newResizedTrackerStructure(&candidate, generation, ft.clock)
+		if err != nil {
+			logger.Error("failed to resize structure", "id", generation.GetID(), "error", err)
+			return NewFairnessTrackerError(err, "Failed to resize a structure").WithSentinel(fairerrors.ErrStructureCreation)
+		}
+		resized[i] = st
+	}
+	ft.current.Store(&trackerSnapshot{config: &candidate, generations: resized})
+
+	if ft.decisionCache != nil {
+		ft.decisionCache.clear()
+	}
+
+	logger.Info("resized structures", "previous_m", previous.M, "previous_l", previous.L, "m", candidate.M, "l", candidate.L)
+	return nil
+}
+
+// GetProbabilityMatrix returns a snapshot of the bucket probabilities of the
+// structure currently making decisions, indexed by level and then by bucket.
+// Dashboards can render it as a heatmap to spot when M is too small for the
+// client population. It returns nil if the structure does not support
+// snapshots.
+func (ft *FairnessTracker) GetProbabilityMatrix() [][]float64 {
+	if snapshotter, ok := ft.current.Load().generations[0].(interface{ ProbabilityMatrix() [][]float64 }); ok {
+		return snapshotter.ProbabilityMatrix()
+	}
+	return nil
+}
+
+// GetConfig returns a copy of the config the tracker is running with,
+// including updates made with ApplyConfig and ResizeTo. PrivacySalt is left
+// out so the config can be exposed on debug endpoints.
+func (ft *FairnessTracker) GetConfig() *config.FairnessTrackerConfig {
+	configCopy := *ft.current.Load().config
+	configCopy.OutcomeMultipliers = maps.Clone(configCopy.OutcomeMultipliers)
+	configCopy.PriorityMultipliers = maps.Clone(configCopy.PriorityMultipliers)
+	configCopy.PrivacySalt = nil
+	return &configCopy
+}
+
+// GetSeeds returns the hash seeds of the structures in rotation order,
+// starting with the one making decisions. Structures that don't expose their
+// seed are reported as 0.
+func (ft *FairnessTracker) GetSeeds() []uint32 {
+	generations := ft.current.Load().generations
+	seeds := make([]uint32, len(generations))
+	for i, generation := range generations {
+		seeds[i] = seedOf(generation)
+	}
+	return seeds
+}
+
+// The hash seed of a structure, or 0 if it doesn't expose it
+func seedOf(structure request.Tracker) uint32 {
+	if seeded, ok := structure.(interface{ GetSeed() uint32 }); ok {
+		return seeded.GetSeed()
+	}
+	return 0
+}
+
+// GetStats returns counters of the activity of the tracker since it was
+// created, along with the structures in rotation and the time left until the
+// next rotation.
+func (ft *FairnessTracker) GetStats() TrackerStats {
+	snapshot := ft.current.Load()
+	generations := make([]GenerationStats, len(snapshot.generations))
+	for i, generation := range snapshot.generations {
+		generations[i] = GenerationStats{ID: generation.GetID(), Seed: seedOf(generation)}
+	}
+
+	nextRotation := time.Unix(0, ft.lastRotation.Load()).Add(snapshot.config.RotationFrequency)
+	return TrackerStats{
+		Requests:          ft.requests.Load(),
+		Throttles:         ft.throttles.Load(),
+		Reports:           ft.reports.Load(),
+		Generations:       generations,
+		UntilNextRotation: max(0, nextRotation.Sub(ft.clock.Now())),
+	}
+}
+
+// PublicStats returns the stats of a decision made by this tracker in the
+// stable form of request.PublicStats, for serializing to API consumers. It
+// returns nil if the result carries no stats, which requires IncludeStats in
+// the config. The decision mode is taken from the current config.
+func (ft *FairnessTracker) PublicStats(result *request.RegisterRequestResult) *request.PublicStats {
+	if result.ResultStats == nil {
+		return nil
+	}
+
+	conf := ft.current.Load().config
+	decisionMode := conf.DecisionMode
+	if decisionMode == "" {
+		decisionMode = config.DecisionModeProbabilistic
+	}
+	stats := &request.PublicStats{
+		SchemaVersion:      request.StatsSchemaVersion,
+		FinalProbability:   result.FinalProbability,
+		LevelProbabilities: slices.Clone(result.ResultStats.BucketProbabilities),
+		StructureID:        result.ResultStats.StructureID,
+		StructureSeed:      result.ResultStats.HashSeed,
+		DecisionMode:       string(decisionMode),
+	}
+	if decisionMode == config.DecisionModeThreshold {
+		threshold := conf.DecisionThreshold
+		stats.ThrottleThreshold = &threshold
+	}
+	return stats
+}
+
+// GetTopThrottledClients returns up to k of the clients that received the most
+// throttle decisions, ordered by descending count. Decisions made in the shadow
+// throttle mode are counted too. Clients are identified by their salted hash
+// in the privacy mode. It returns nil unless
+// TopThrottledClientsCapacity is set in the config.
+func (ft *FairnessTracker) GetTopThrottledClients(k int) []data.HeavyHitter {
+	if ft.topThrottled == nil {
+		return nil
+	}
+	return ft.topThrottled.Top(k)
+}
+
+// Count a decision, and record throttle decisions in the offenders sketch and
+// notify the observer of them
+func (ft *FairnessTracker) recordDecision(conf *config.FairnessTrackerConfig, clientIdentifier []byte, resp *request.RegisterRequestResult) {
+	ft.requests.Add(1)
+	if !resp.ShouldThrottle && !resp.ShadowThrottled {
+		return
+	}
+	ft.throttles.Add(1)
+
+	if ft.topThrottled == nil && conf.Observer == nil {
+		return
+	}
+	clientIdentifier = ft.outputIdentifier(clientIdentifier)
+	if ft.topThrottled != nil {
+		ft.topThrottled.Add(clientIdentifier)
+	}
+	if conf.Observer != nil {
+		conf.Observer.OnThrottle(clientIdentifier, resp)
+	}
+}
+
 // Close stops the background rotation goroutine and releases ticker resources.
+// It is safe to call more than once. Operations on a closed tracker make no
+// decisions and return errors matching fairerrors.ErrClosed.
 func (ft *FairnessTracker) Close() {
+	if !ft.state.CompareAndSwap(stateRunning, stateClosed) {
+		return
+	}
 	close(ft.stopRotation)
 	ft.ticker.Stop()
 }
+
+// Whether the tracker has been closed
+func (ft *FairnessTracker) isClosed() bool {
+	return ft.state.Load() == stateClosed
+}
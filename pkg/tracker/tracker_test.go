@@ -1,12 +1,23 @@
 package tracker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/config/decay"
+	"github.com/satmihir/fair/pkg/data"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/identity"
 	"github.com/satmihir/fair/pkg/logger"
 	"github.com/satmihir/fair/pkg/request"
 	"github.com/satmihir/fair/pkg/testutils"
@@ -49,24 +60,914 @@ func TestEndToEnd(t *testing.T) {
 	assert.False(t, resp.ShouldThrottle)
 }
 
+func TestReportOutcomeWithCost(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trk, err := trkB.BuildWithDefaultConfig()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ctx := context.Background()
+	id := []byte("expensive_client")
+
+	// A single failure costing as much as the tolerable number of bad requests
+	// fully blocks the flow
+	trk.ReportOutcomeWithCost(ctx, id, request.OutcomeFailure, 25)
+
+	resp := trk.RegisterRequest(ctx, id)
+	require.True(t, resp.ShouldThrottle)
+}
+
+// Records the outcomes reported with a cost
+type outcomeRecordingTracker struct {
+	fakeTracker
+	outcomes []request.Outcome
+	costs    []float64
+}
+
+func (f *outcomeRecordingTracker) ReportOutcomeWithCost(_ context.Context, _ []byte, outcome request.Outcome, cost float64) *request.ReportOutcomeResult {
+	f.outcomes = append(f.outcomes, outcome)
+	f.costs = append(f.costs, cost)
+	return &request.ReportOutcomeResult{}
+}
+
+func TestReportLatency(t *testing.T) {
+	testCases := []struct {
+		name            string
+		latency         time.Duration
+		expectedOutcome request.Outcome
+		expectedCost    float64
+	}{
+		{name: "below target", latency: 50 * time.Millisecond, expectedOutcome: request.OutcomeSuccess, expectedCost: 1},
+		{name: "at target", latency: 100 * time.Millisecond, expectedOutcome: request.OutcomeSuccess, expectedCost: 1},
+		{name: "between target and limit", latency: 175 * time.Millisecond, expectedOutcome: request.OutcomeFailure, expectedCost: 0.25},
+		{name: "at limit", latency: 400 * time.Millisecond, expectedOutcome: request.OutcomeFailure, expectedCost: 1},
+		{name: "above limit", latency: time.Second, expectedOutcome: request.OutcomeFailure, expectedCost: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prevConstructor := newTrackerStructureWithClock
+			t.Cleanup(func() {
+				newTrackerStructureWithClock = prevConstructor
+			})
+			structures := map[uint64]*outcomeRecordingTracker{}
+			newTrackerStructureWithClock = func(_ *config.FairnessTrackerConfig, id uint64, _ bool, _ utils.IClock) (request.Tracker, error) {
+				structures[id] = &outcomeRecordingTracker{fakeTracker: fakeTracker{id: id}}
+				return structures[id], nil
+			}
+			conf := config.DefaultFairnessTrackerConfig()
+			conf.LatencyTarget = 100 * time.Millisecond
+			conf.LatencyLimit = 400 * time.Millisecond
+			trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+			require.NoError(t, err)
+			defer trk.Close()
+
+			trk.ReportLatency(context.Background(), []byte("client"), tc.latency)
+
+			for _, structure := range structures {
+				require.Equal(t, []request.Outcome{tc.expectedOutcome}, structure.outcomes)
+				require.Len(t, structure.costs, 1)
+				require.InDelta(t, tc.expectedCost, structure.costs[0], 1e-9)
+			}
+		})
+	}
+}
+
+func TestReportLatency_Disabled(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("slow_client")
+
+	for i := 0; i < 100; i++ {
+		trk.ReportLatency(ctx, id, time.Hour)
+	}
+
+	require.False(t, trk.RegisterRequest(ctx, id).ShouldThrottle)
+}
+
+func TestNewFairnessTracker_InvalidLatencyThresholds(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.LatencyTarget = time.Second
+	conf.LatencyLimit = time.Second
+
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+
+	require.Nil(t, trk)
+	require.Error(t, err)
+}
+
+func TestGenerations(t *testing.T) {
+	prevConstructor := newTrackerStructureWithClock
+	t.Cleanup(func() {
+		newTrackerStructureWithClock = prevConstructor
+	})
+	newTrackerStructureWithClock = func(_ *config.FairnessTrackerConfig, id uint64, _ bool, _ utils.IClock) (request.Tracker, error) {
+		return &outcomeRecordingTracker{fakeTracker: fakeTracker{id: id}}, nil
+	}
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.NumGenerations = 4
+	conf.Observer = observer
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+
+	trk.ReportOutcomeWithCost(context.Background(), []byte("client"), request.OutcomeFailure, 2)
+
+	expectedCosts := []float64{2, 2, 1, 0.5}
+	for i, generation := range trk.current.Load().generations {
+		require.Equal(t, uint64(i+1), generation.GetID())
+		require.Equal(t, []float64{expectedCosts[i]}, generation.(*outcomeRecordingTracker).costs)
+	}
+
+	ticker.ch <- time.Now()
+	require.Equal(t, rotation{retiredID: 1, newID: 5}, <-observer.rotations)
+
+	var ids []uint64
+	for _, generation := range trk.current.Load().generations {
+		ids = append(ids, generation.GetID())
+	}
+	require.Equal(t, []uint64{2, 3, 4, 5}, ids)
+}
+
+func TestNewFairnessTracker_InvalidNumGenerations(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.NumGenerations = 1
+
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+
+	require.Nil(t, trk)
+	require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+}
+
+func TestNewFairnessTracker_InvalidRotationFrequency(t *testing.T) {
+	for _, frequency := range []time.Duration{0, -time.Second} {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.RotationFrequency = frequency
+
+		trk, err := NewFairnessTracker(conf)
+		require.Nil(t, trk)
+		require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+
+		rt, err := NewRecordingTracker(conf, &bytes.Buffer{})
+		require.Nil(t, rt)
+		require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+	}
+}
+
+func TestGetProbabilityMatrix(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trkB.SetL(2)
+	trkB.SetM(10)
+	trk, err := trkB.Build()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	trk.ReportOutcome(context.Background(), []byte("client"), request.OutcomeFailure)
+	matrix := trk.GetProbabilityMatrix()
+
+	require.Len(t, matrix, 2)
+	require.Len(t, matrix[0], 10)
+	require.Positive(t, slices.Max(matrix[0]))
+}
+
+func TestContextDone(t *testing.T) {
+	observer := &recordingObserver{}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Observer = observer
+	conf.MaxRPS = 1
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	id := []byte("client")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	resp := trk.RegisterRequest(ctx, id)
+	require.ErrorIs(t, resp.Err, context.DeadlineExceeded)
+	require.False(t, resp.ShouldThrottle)
+	results := trk.RegisterRequests(ctx, [][]byte{id, id})
+	for _, result := range results {
+		require.ErrorIs(t, result.Err, context.DeadlineExceeded)
+	}
+
+	// Aborted requests don't use up the rate limit
+	require.False(t, trk.RegisterRequest(context.Background(), id).ShouldThrottle)
+	require.Empty(t, observer.throttled)
+
+	// Outcomes are still recorded with an expired context
+	timedOut := []byte("timed_out_client")
+	trk.ReportOutcomeWithCost(ctx, timedOut, request.OutcomeTimeout, 25)
+	resp = trk.RegisterRequest(context.Background(), timedOut)
+	require.True(t, resp.ShouldThrottle)
+	require.False(t, resp.RateLimited)
+}
+
+func TestMinPassRate_Recovery(t *testing.T) {
+	// Returns how many requests a client that stopped misbehaving sends before
+	// it is fully admitted again, or -1 if it doesn't recover in time. The
+	// decisions are drawn from a seeded source so the count is reproducible.
+	recoveryRequests := func(minPassRate float64) int {
+		conf := config.DefaultFairnessTrackerConfig()
+		conf.Pi = 0.5
+		conf.Pd = 0.1
+		conf.Lambda = 0
+		conf.MinPassRate = minPassRate
+		trk, err := NewFairnessTrackerWithClockAndTicker(conf, newFakeClock(), newFakeTicker())
+		require.NoError(t, err)
+		defer trk.Close()
+		ctx := context.Background()
+		id := []byte("client")
+		rng := rand.New(rand.NewSource(1))
+		for range 10 {
+			trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+		}
+
+		for i := range 1000 {
+			resp := &request.RegisterRequestResult{}
+			draws := data.Draws{Throttle: rng.Float64(), Pass: rng.Float64()}
+			trk.registerRequest(ctx, trk.current.Load(), id, request.PriorityNormal, &draws, resp)
+			if resp.FinalProbability == 0 {
+				return i
+			}
+			if !resp.ShouldThrottle {
+				trk.ReportOutcome(ctx, id, request.OutcomeSuccess)
+			}
+		}
+		return -1
+	}
+
+	require.Equal(t, -1, recoveryRequests(0), "a fully throttled client never gets a success in")
+	requests := recoveryRequests(0.1)
+	require.Positive(t, requests)
+	t.Logf("recovered after %d requests with a 10%% minimum pass rate", requests)
+}
+
+func TestReportResourceOutcome(t *testing.T) {
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.ResourceBlastRadius = 2
+	conf.Observer = observer
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	shard := []byte("shard-1")
+	heavy, light, rare, bystander := []byte("heavy"), []byte("light"), []byte("rare"), []byte("bystander")
+	for range 8 {
+		trk.RecordResourceAccess(heavy, shard)
+	}
+	trk.RecordResourceAccess(light, shard)
+	trk.RecordResourceAccess(light, shard)
+	trk.RecordResourceAccess(rare, shard)
+	trk.RecordResourceAccess(bystander, []byte("shard-2"))
+
+	result := trk.ReportResourceOutcome(ctx, shard, request.OutcomeFailure)
+
+	require.NoError(t, result.Err)
+	require.InDelta(t, 0.4, trk.RegisterRequest(ctx, heavy).FinalProbability, 1e-9)
+	require.InDelta(t, 0.1, trk.RegisterRequest(ctx, light).FinalProbability, 1e-9)
+	require.Zero(t, trk.RegisterRequest(ctx, rare).FinalProbability, "clients outside the blast radius are spared")
+	require.Zero(t, trk.RegisterRequest(ctx, bystander).FinalProbability, "clients of other resources are spared")
+
+	// Accesses are forgotten on rotation
+	ticker.ch <- time.Now()
+	<-observer.rotations
+	trk.ReportResourceOutcome(ctx, shard, request.OutcomeFailure)
+	require.InDelta(t, 0.4, trk.RegisterRequest(ctx, heavy).FinalProbability, 1e-9)
+}
+
+func TestReportResourceOutcome_Disabled(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("client")
+
+	trk.RecordResourceAccess(id, []byte("shard-1"))
+	result := trk.ReportResourceOutcome(ctx, []byte("shard-1"), request.OutcomeFailure)
+
+	require.NoError(t, result.Err)
+	require.Zero(t, trk.RegisterRequest(ctx, id).FinalProbability)
+}
+
+func TestReportOutcomeByToken(t *testing.T) {
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeDefer
+	conf.PendingRequestTTL = time.Second
+	conf.Observer = observer
+	clk := newFakeClock()
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, clk, ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	reported, forgotten := []byte("reported"), []byte("forgotten")
+
+	token := trk.RegisterRequest(ctx, reported).Token
+	require.NotZero(t, token)
+	require.NotZero(t, trk.RegisterRequest(ctx, forgotten).Token)
+	require.Equal(t, 1, trk.GetInFlightCount(reported))
+
+	require.NoError(t, trk.ReportOutcomeByToken(ctx, token, request.OutcomeFailure).Err)
+	require.Zero(t, trk.GetInFlightCount(reported))
+	require.ErrorIs(t, trk.ReportOutcomeByToken(ctx, token, request.OutcomeFailure).Err, fairerrors.ErrUnknownToken)
+	require.InDelta(t, 0.5, trk.RegisterRequest(ctx, reported).FinalProbability, 1e-9)
+
+	// The unreported request times out on rotation even without new requests
+	clk.Advance(time.Second)
+	ticker.ch <- time.Now()
+	<-observer.rotations
+	require.Zero(t, trk.GetInFlightCount(forgotten))
+	require.InDelta(t, 0.5, trk.RegisterRequest(ctx, forgotten).FinalProbability, 1e-9)
+}
+
+func TestReportOutcomeByToken_Disabled(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+
+	require.Zero(t, trk.RegisterRequest(ctx, []byte("client")).Token)
+	require.ErrorIs(t, trk.ReportOutcomeByToken(ctx, 1, request.OutcomeSuccess).Err, fairerrors.ErrUnknownToken)
+	require.Zero(t, trk.GetInFlightCount([]byte("client")))
+}
+
+func TestSetOverloadFactor(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.25
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.5
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	good, bad := []byte("good"), []byte("bad")
+	trk.ReportOutcome(ctx, bad, request.OutcomeFailure)
+	require.Equal(t, 1.0, trk.GetOverloadFactor())
+	require.False(t, trk.RegisterRequest(ctx, bad).ShouldThrottle)
+
+	require.NoError(t, trk.SetOverloadFactor(3))
+	resp := trk.RegisterRequest(ctx, bad)
+	require.True(t, resp.ShouldThrottle, "the offender is throttled harder while the resource is stressed")
+	require.InDelta(t, 0.75, resp.FinalProbability, 1e-9)
+	require.Zero(t, trk.RegisterRequest(ctx, good).FinalProbability)
+
+	require.NoError(t, trk.SetOverloadFactor(10))
+	require.Equal(t, 1.0, trk.RegisterRequest(ctx, bad).FinalProbability, "the probability is capped at 1")
+
+	require.NoError(t, trk.SetOverloadFactor(0.5))
+	require.InDelta(t, 0.125, trk.RegisterRequest(ctx, bad).FinalProbability, 1e-9)
+
+	for _, factor := range []float64{-1, math.NaN(), math.Inf(1)} {
+		require.ErrorIs(t, trk.SetOverloadFactor(factor), fairerrors.ErrInvalidConfig)
+	}
+	require.Equal(t, 0.5, trk.GetOverloadFactor())
+}
+
+func TestRegisterRequestWithPriority(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.25
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.4
+	conf.PriorityMultipliers = map[request.Priority]float64{request.PriorityHigh: 0.5, request.PriorityLow: 2}
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	good, bad := []byte("good"), []byte("bad")
+	trk.ReportOutcome(ctx, bad, request.OutcomeFailure)
+
+	resp := trk.RegisterRequestWithPriority(ctx, bad, request.PriorityLow)
+	require.True(t, resp.ShouldThrottle, "low priority traffic is shed first")
+	require.InDelta(t, 0.5, resp.FinalProbability, 1e-9)
+	require.InDelta(t, 0.25, trk.RegisterRequestWithPriority(ctx, bad, request.PriorityNormal).FinalProbability, 1e-9)
+	require.InDelta(t, 0.125, trk.RegisterRequestWithPriority(ctx, bad, request.PriorityHigh).FinalProbability, 1e-9)
+	require.Zero(t, trk.RegisterRequestWithPriority(ctx, good, request.PriorityLow).FinalProbability)
+
+	require.NoError(t, trk.SetOverloadFactor(3))
+	require.InDelta(t, 0.375, trk.RegisterRequestWithPriority(ctx, bad, request.PriorityHigh).FinalProbability, 1e-9)
+	require.Equal(t, 1.0, trk.RegisterRequestWithPriority(ctx, bad, request.PriorityLow).FinalProbability, "the probability is capped at 1")
+}
+
+func TestIdentifierNormalizer(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeDefer
+	conf.PendingRequestTTL = time.Minute
+	conf.TopThrottledClientsCapacity = 10
+	conf.IdentifierNormalizer = identity.Chain(identity.TrimSpace(), identity.Lowercase())
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+
+	trk.ReportOutcome(ctx, []byte("ClientA"), request.OutcomeFailure)
+
+	require.Equal(t, 0.5, trk.RegisterRequest(ctx, []byte("clienta ")).FinalProbability)
+	require.Equal(t, 1, trk.GetInFlightCount([]byte(" CLIENTA")))
+	require.Zero(t, trk.RegisterRequest(ctx, []byte("clientb")).FinalProbability)
+
+	trk.ReportTieredOutcome(ctx, []byte("Tenant"), []byte("User"), request.OutcomeFailure)
+	require.InDelta(t, 0.5, trk.RegisterTieredRequest(ctx, []byte("tenant "), []byte("user")).FinalProbability, 1e-9)
+}
+
+func TestDecayFunction_Window(t *testing.T) {
+	clk := newFakeClock()
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.DecayFunction = decay.Window(time.Minute)
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, clk, newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("client")
+	trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+
+	// Registering requests doesn't restart the window
+	for range 5 {
+		clk.Advance(10 * time.Second)
+		require.Equal(t, 0.5, trk.RegisterRequest(ctx, id).FinalProbability)
+	}
+	clk.Advance(10 * time.Second)
+	require.Zero(t, trk.RegisterRequest(ctx, id).FinalProbability)
+}
+
+func TestClose(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	ctx := context.Background()
+	id := []byte("client")
+
+	trk.Close()
+	require.NotPanics(t, trk.Close)
+
+	resp := trk.RegisterRequest(ctx, id)
+	require.ErrorIs(t, resp.Err, fairerrors.ErrClosed)
+	require.False(t, resp.ShouldThrottle)
+	for _, result := range trk.RegisterRequests(ctx, [][]byte{id, id}) {
+		require.ErrorIs(t, result.Err, fairerrors.ErrClosed)
+	}
+	require.ErrorIs(t, trk.ReportOutcome(ctx, id, request.OutcomeFailure).Err, fairerrors.ErrClosed)
+	require.ErrorIs(t, trk.ReportLatency(ctx, id, time.Second).Err, fairerrors.ErrClosed)
+	require.ErrorIs(t, trk.ReportResourceOutcome(ctx, id, request.OutcomeFailure).Err, fairerrors.ErrClosed)
+	for _, result := range trk.ReportOutcomes(ctx, []request.OutcomeReport{{ClientIdentifier: id, Outcome: request.OutcomeFailure}}) {
+		require.ErrorIs(t, result.Err, fairerrors.ErrClosed)
+	}
+	require.ErrorIs(t, trk.ApplyConfig(config.DefaultFairnessTrackerConfig()), fairerrors.ErrClosed)
+	require.ErrorIs(t, trk.ResizeTo(config.DefaultFairnessTrackerConfig()), fairerrors.ErrClosed)
+}
+
+func TestGetStats(t *testing.T) {
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.DecisionMode = config.DecisionModeThreshold
+	conf.DecisionThreshold = 0.9
+	conf.RotationFrequency = time.Minute
+	conf.Observer = observer
+	clk := newFakeClock()
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, clk, ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	good, bad := []byte("good"), []byte("bad")
+
+	trk.ReportOutcome(ctx, bad, request.OutcomeFailure)
+	trk.ReportOutcome(ctx, bad, request.OutcomeFailure)
+	trk.RegisterRequest(ctx, good)
+	trk.RegisterRequest(ctx, good)
+	trk.RegisterRequest(ctx, bad)
+	clk.Advance(20 * time.Second)
+
+	stats := trk.GetStats()
+	require.Equal(t, uint64(3), stats.Requests)
+	require.Equal(t, uint64(1), stats.Throttles)
+	// Every outcome is counted once per client flow, not per generation
+	require.Equal(t, uint64(2), stats.Reports)
+	require.Equal(t, 40*time.Second, stats.UntilNextRotation)
+	seeds := trk.GetSeeds()
+	require.Equal(t, []GenerationStats{{ID: 1, Seed: seeds[0]}, {ID: 2, Seed: seeds[1]}}, stats.Generations)
+	require.NotEqual(t, seeds[0], seeds[1])
+
+	ticker.ch <- time.Now()
+	<-observer.rotations
+	stats = trk.GetStats()
+	require.Equal(t, time.Minute, stats.UntilNextRotation)
+	require.Equal(t, uint64(2), stats.Generations[0].ID)
+	require.Equal(t, seeds[1], stats.Generations[0].Seed)
+	require.Equal(t, uint64(3), stats.Generations[1].ID)
+}
+
+func TestGetConfig(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.OutcomeMultipliers = map[request.Outcome]float64{request.OutcomeTimeout: 2}
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+
+	update := config.DefaultFairnessTrackerConfig()
+	update.Pi = 0.5
+	update.Pd = 0.1
+	require.NoError(t, trk.ApplyConfig(update))
+
+	active := trk.GetConfig()
+	require.Equal(t, 0.5, active.Pi)
+	require.Equal(t, conf.M, active.M)
+
+	active.Pi = 0.9
+	active.OutcomeMultipliers[request.OutcomeTimeout] = 3
+	require.Equal(t, 0.5, trk.GetConfig().Pi, "the returned config is a copy")
+	require.Equal(t, 2.0, trk.GetConfig().OutcomeMultipliers[request.OutcomeTimeout])
+
+	conf.OutcomeMultipliers[request.OutcomeTimeout] = 4
+	require.Equal(t, 2.0, trk.GetConfig().OutcomeMultipliers[request.OutcomeTimeout], "the caller's map is not shared")
+}
+
+func TestPublicStats(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.M = 10
+	conf.L = 2
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	conf.HashSeed = 42
+	conf.IncludeStats = true
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("client")
+	trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+
+	resp := trk.RegisterRequest(ctx, id)
+	stats := trk.PublicStats(resp)
+
+	require.Equal(t, &request.PublicStats{
+		SchemaVersion:      request.StatsSchemaVersion,
+		FinalProbability:   0.5,
+		LevelProbabilities: []float64{0.5, 0.5},
+		StructureID:        resp.ResultStats.StructureID,
+		StructureSeed:      resp.ResultStats.HashSeed,
+		DecisionMode:       "probabilistic",
+	}, stats)
+	raw, err := json.Marshal(stats)
+	require.NoError(t, err)
+	require.JSONEq(t, fmt.Sprintf(`{"schema_version": 1, "final_probability": 0.5, "level_probabilities": [0.5, 0.5],
+		"structure_id": %d, "structure_seed": %d, "decision_mode": "probabilistic"}`, stats.StructureID, stats.StructureSeed), string(raw))
+
+	update := *conf
+	update.DecisionMode = config.DecisionModeThreshold
+	update.DecisionThreshold = 0.7
+	require.NoError(t, trk.ApplyConfig(&update))
+	stats = trk.PublicStats(trk.RegisterRequest(ctx, id))
+	require.Equal(t, "threshold", stats.DecisionMode)
+	require.NotNil(t, stats.ThrottleThreshold)
+	require.Equal(t, 0.7, *stats.ThrottleThreshold)
+
+	noStats, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer noStats.Close()
+	require.Nil(t, noStats.PublicStats(noStats.RegisterRequest(ctx, id)))
+}
+
+func TestGetTopThrottledClients(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trkB.SetTopThrottledClientsCapacity(10)
+	trk, err := trkB.Build()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ctx := context.Background()
+	bad := []byte("bad_client")
+	good := []byte("good_client")
+	trk.ReportOutcomeWithCost(ctx, bad, request.OutcomeFailure, 25)
+
+	for i := 0; i < 5; i++ {
+		trk.RegisterRequest(ctx, bad)
+		trk.RegisterRequest(ctx, good)
+	}
+	trk.RegisterRequests(ctx, [][]byte{bad, good})
+
+	top := trk.GetTopThrottledClients(5)
+	require.Len(t, top, 1)
+	require.Equal(t, bad, top[0].Key)
+	require.Equal(t, uint64(6), top[0].Count)
+}
+
+func TestGetTopThrottledClients_Disabled(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trk, err := trkB.BuildWithDefaultConfig()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ctx := context.Background()
+	bad := []byte("bad_client")
+	trk.ReportOutcomeWithCost(ctx, bad, request.OutcomeFailure, 25)
+	trk.RegisterRequest(ctx, bad)
+
+	require.Nil(t, trk.GetTopThrottledClients(5))
+}
+
+func TestApplyConfig(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("client")
+
+	update := config.DefaultFairnessTrackerConfig()
+	update.Pi = 0.5
+	update.Pd = 0.1
+	update.RotationFrequency = time.Minute
+	update.ThrottleMode = config.ThrottleModeShadow
+	update.M = 7
+	err = trk.ApplyConfig(update)
+
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Minute}, ticker.resets)
+	require.Equal(t, uint32(1000), trk.current.Load().config.M, "geometry should not change")
+	require.Equal(t, config.DefaultFairnessTrackerConfig().Pi, conf.Pi, "the caller's config should not change")
+
+	// Two failures at the new Pi fully block the client, but shadow mode never throttles
+	trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+	trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+	resp := trk.RegisterRequest(ctx, id)
+	require.False(t, resp.ShouldThrottle)
+	require.True(t, resp.ShadowThrottled)
+}
+
+func TestApplyConfig_Invalid(t *testing.T) {
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	before := *trk.current.Load().config
+
+	invalidPd := config.DefaultFairnessTrackerConfig()
+	invalidPd.Pd = invalidPd.Pi * 2
+	zeroRotation := config.DefaultFairnessTrackerConfig()
+	zeroRotation.RotationFrequency = 0
+
+	for name, update := range map[string]*config.FairnessTrackerConfig{
+		"nil":           nil,
+		"Pd above Pi":   invalidPd,
+		"zero rotation": zeroRotation,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := trk.ApplyConfig(update)
+
+			require.Error(t, err)
+			if update == nil {
+				require.ErrorIs(t, err, fairerrors.ErrNilConfig)
+			} else {
+				require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+			}
+			require.Equal(t, before.Pd, trk.current.Load().config.Pd)
+			require.Equal(t, before.RotationFrequency, trk.current.Load().config.RotationFrequency)
+		})
+	}
+}
+
+type rotation struct {
+	retiredID uint64
+	newID     uint64
+}
+
+// Requests never lock the tracker, so they must see consistent structures and
+// tunables while rotations, config changes and resizes publish new ones. Run
+// with -race.
+func TestConcurrentUpdates(t *testing.T) {
+	observer := &recordingObserver{rotations: make(chan rotation, 1)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.DecisionMode = config.DecisionModeDefer
+	conf.Observer = observer
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := []byte(fmt.Sprintf("client-%d", g))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				assert.NoError(t, trk.RegisterRequest(ctx, id).Err)
+				assert.NoError(t, trk.ReportOutcome(ctx, id, request.OutcomeFailure).Err)
+			}
+		}()
+	}
+
+	for i := range 20 {
+		update := config.DefaultFairnessTrackerConfig()
+		update.DecisionMode = config.DecisionModeDefer
+		update.Pi = 0.1 + float64(i)/100
+		require.NoError(t, trk.ApplyConfig(update))
+
+		ticker.ch <- time.Now()
+		<-observer.rotations
+	}
+	resized := config.DefaultFairnessTrackerConfig()
+	resized.M *= 2
+	require.NoError(t, trk.ResizeTo(resized))
+	close(stop)
+	wg.Wait()
+
+	current := trk.current.Load()
+	require.InDelta(t, 0.29, current.config.Pi, 1e-9)
+	require.Equal(t, resized.M, current.config.M)
+	for _, generation := range current.generations {
+		require.Len(t, generation.(*data.Structure).ProbabilityMatrix()[0], int(resized.M))
+	}
+}
+
+type recordingObserver struct {
+	config.BaseObserver
+	throttled [][]byte
+	rotations chan rotation
+}
+
+func (o *recordingObserver) OnThrottle(clientIdentifier []byte, _ *request.RegisterRequestResult) {
+	o.throttled = append(o.throttled, clientIdentifier)
+}
+
+func (o *recordingObserver) OnRotation(retiredID, newID uint64) {
+	o.rotations <- rotation{retiredID: retiredID, newID: newID}
+}
+
+func TestResizeTo(t *testing.T) {
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Pi = 0.5
+	conf.Pd = 0.1
+	conf.Lambda = 0
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	id := []byte("client")
+	trk.ReportOutcome(ctx, id, request.OutcomeFailure)
+
+	update := config.DefaultFairnessTrackerConfig()
+	update.M = 2 * conf.M
+	update.Pi = 0.9
+	err = trk.ResizeTo(update)
+
+	require.NoError(t, err)
+	require.Equal(t, 2*conf.M, trk.current.Load().config.M)
+	require.Equal(t, 0.5, trk.current.Load().config.Pi, "tunables should not change")
+	for _, generation := range trk.current.Load().generations {
+		require.Len(t, generation.(*data.Structure).ProbabilityMatrix()[0], int(2*conf.M))
+	}
+	require.InDelta(t, 0.5, trk.RegisterRequest(ctx, id).FinalProbability, 1e-9, "the client's state should carry over")
+
+	update.M = 0
+	require.ErrorIs(t, trk.ResizeTo(update), fairerrors.ErrInvalidConfig)
+	require.ErrorIs(t, trk.ResizeTo(nil), fairerrors.ErrNilConfig)
+	require.Equal(t, 2*conf.M, trk.current.Load().config.M)
+}
+
+func TestResizeTo_StructureError(t *testing.T) {
+	prevConstructor := newResizedTrackerStructure
+	t.Cleanup(func() {
+		newResizedTrackerStructure = prevConstructor
+	})
+	newResizedTrackerStructure = func(_ *config.FairnessTrackerConfig, _ request.Tracker, _ utils.IClock) (request.Tracker, error) {
+		return nil, fmt.Errorf("resize failed")
+	}
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+
+	update := config.DefaultFairnessTrackerConfig()
+	update.M = 7
+	err = trk.ResizeTo(update)
+
+	require.ErrorIs(t, err, fairerrors.ErrStructureCreation)
+	require.Equal(t, uint32(1000), trk.current.Load().config.M, "a failed resize should keep the old geometry")
+}
+
+func TestObserver_OnThrottle(t *testing.T) {
+	observer := &recordingObserver{}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Observer = observer
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), newFakeTicker())
+	require.NoError(t, err)
+	defer trk.Close()
+	ctx := context.Background()
+	bad := []byte("bad_client")
+	good := []byte("good_client")
+	trk.ReportOutcomeWithCost(ctx, bad, request.OutcomeFailure, 25)
+
+	trk.RegisterRequest(ctx, good)
+	trk.RegisterRequest(ctx, bad)
+	trk.RegisterRequests(ctx, [][]byte{good, bad})
+
+	require.Equal(t, [][]byte{bad, bad}, observer.throttled)
+}
+
+func TestObserver_OnRotation(t *testing.T) {
+	observer := &recordingObserver{rotations: make(chan rotation, 2)}
+	conf := config.DefaultFairnessTrackerConfig()
+	conf.Observer = observer
+	ticker := newFakeTicker()
+	trk, err := NewFairnessTrackerWithClockAndTicker(conf, utils.NewRealClock(), ticker)
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ticker.ch <- time.Now()
+	first := <-observer.rotations
+	ticker.ch <- time.Now()
+	second := <-observer.rotations
+
+	require.Equal(t, rotation{retiredID: 1, newID: 3}, first)
+	require.Equal(t, rotation{retiredID: 2, newID: 4}, second)
+}
+
+func TestBatchEndToEnd(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trk, err := trkB.BuildWithDefaultConfig()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ctx := context.Background()
+	bad := []byte("bad_client")
+	good := []byte("good_client")
+
+	reports := make([]request.OutcomeReport, 0, 31)
+	for i := 0; i < 31; i++ {
+		reports = append(reports, request.OutcomeReport{ClientIdentifier: bad, Outcome: request.OutcomeFailure})
+	}
+	outcomeResults := trk.ReportOutcomes(ctx, reports)
+	require.Len(t, outcomeResults, len(reports))
+
+	results := trk.RegisterRequests(ctx, [][]byte{bad, good})
+
+	require.Len(t, results, 2)
+	require.True(t, results[0].ShouldThrottle)
+	require.False(t, results[1].ShouldThrottle)
+}
+
+func TestBatchEmpty(t *testing.T) {
+	trkB := NewFairnessTrackerBuilder()
+	trk, err := trkB.BuildWithDefaultConfig()
+	require.NoError(t, err)
+	defer trk.Close()
+
+	ctx := context.Background()
+
+	require.Empty(t, trk.RegisterRequests(ctx, nil))
+	require.Empty(t, trk.ReportOutcomes(ctx, nil))
+}
+
 func TestRotation(t *testing.T) {
 	trkB := NewFairnessTrackerBuilder()
 	trkB.SetRotationFrequency(1 * time.Second)
 	trk, err := trkB.Build()
 	assert.NoError(t, err)
+	defer trk.Close()
 
 	for i := 0; i < 3; i++ {
-		trk.rotationLock.RLock()
-		diff := int(trk.secondaryStructure.GetID() - trk.mainStructure.GetID())
-		trk.rotationLock.RUnlock()
+		generations := trk.current.Load().generations
+		diff := int(generations[1].GetID() - generations[0].GetID())
 
 		assert.Equal(t, diff, 1)
 		time.Sleep(1 * time.Second)
 	}
 
-	trk.rotationLock.RLock()
-	secID := trk.secondaryStructure.GetID()
-	trk.rotationLock.RUnlock()
+	secID := trk.current.Load().generations[1].GetID()
 
 	assert.True(t, secID >= 2)
 }
@@ -85,6 +986,7 @@ func TestFairnessTrackerBuilder_BuildWithConfig(t *testing.T) {
 	trkWithNilConfig, errWithNilConfig = NewFairnessTracker(nil)
 	assert.Error(t, errWithNilConfig)
 	testutils.TestError(t, &FairnessTrackerError{}, errWithNilConfig, "Configuration cannot be nil", nil)
+	assert.ErrorIs(t, errWithNilConfig, fairerrors.ErrNilConfig)
 	assert.Nil(t, trkWithNilConfig)
 }
 func TestNewFairnessTrackerWithClockAndTicker_NilConfig(t *testing.T) {
@@ -94,12 +996,14 @@ func TestNewFairnessTrackerWithClockAndTicker_NilConfig(t *testing.T) {
 	assert.Nil(t, ft)
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "trackerConfig must not be nil")
+		assert.ErrorIs(t, err, fairerrors.ErrNilConfig)
 	}
 }
 
 type fakeTicker struct {
 	ch      chan time.Time
 	stopped bool
+	resets  []time.Duration
 }
 
 func newFakeTicker() *fakeTicker {
@@ -116,6 +1020,10 @@ func (f *fakeTicker) Stop() {
 	f.stopped = true
 }
 
+func (f *fakeTicker) Reset(duration time.Duration) {
+	f.resets = append(f.resets, duration)
+}
+
 type fakeTracker struct {
 	id uint64
 }
@@ -128,10 +1036,18 @@ func (f *fakeTracker) RegisterRequest(_ context.Context, _ []byte) *request.Regi
 	return &request.RegisterRequestResult{}
 }
 
+func (f *fakeTracker) RegisterRequestInto(_ context.Context, _ []byte, result *request.RegisterRequestResult) {
+	*result = request.RegisterRequestResult{}
+}
+
 func (f *fakeTracker) ReportOutcome(_ context.Context, _ []byte, _ request.Outcome) *request.ReportOutcomeResult {
 	return &request.ReportOutcomeResult{}
 }
 
+func (f *fakeTracker) ReportOutcomeWithCost(_ context.Context, _ []byte, _ request.Outcome, _ float64) *request.ReportOutcomeResult {
+	return &request.ReportOutcomeResult{}
+}
+
 func (f *fakeTracker) Close() {}
 
 type fatalCaptureLogger struct {
@@ -162,6 +1078,7 @@ func TestNewFairnessTrackerWithClockAndTicker_FirstStructureError(t *testing.T)
 	require.Nil(t, ft)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Failed to create a structure")
+	require.ErrorIs(t, err, fairerrors.ErrStructureCreation)
 }
 
 func TestNewFairnessTrackerWithClockAndTicker_SecondStructureError(t *testing.T) {
@@ -183,6 +1100,7 @@ func TestNewFairnessTrackerWithClockAndTicker_SecondStructureError(t *testing.T)
 	require.Nil(t, ft)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Failed to create a structure")
+	require.ErrorIs(t, err, fairerrors.ErrStructureCreation)
 }
 
 func TestNewFairnessTrackerWithClockAndTicker_RotationStructureError(t *testing.T) {
@@ -222,3 +1140,66 @@ func TestNewFairnessTrackerWithClockAndTicker_RotationStructureError(t *testing.
 	ft.Close()
 	require.True(t, ticker.stopped)
 }
+
+// Benchmarks allocations on the single-request paths of the tracker, which
+// should not allocate with the default config when results are reused
+func BenchmarkFairnessTrackerAllocs(b *testing.B) {
+	ctx := context.Background()
+	id := []byte("client")
+	trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+	require.NoError(b, err)
+	defer trk.Close()
+
+	b.Run("RegisterRequest", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			trk.RegisterRequest(ctx, id)
+		}
+	})
+
+	b.Run("RegisterRequestInto", func(b *testing.B) {
+		result := &request.RegisterRequestResult{}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			trk.RegisterRequestInto(ctx, id, result)
+		}
+	})
+
+	b.Run("ReportOutcome", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			trk.ReportOutcome(ctx, id, request.OutcomeSuccess)
+		}
+	})
+}
+
+// Benchmarks the throughput of decisions under contention. Requests take no
+// lock on the tracker, so goroutines only contend on the buckets of clients
+// that collide. Run with -cpu to vary GOMAXPROCS; the parallelism multiplies it.
+func BenchmarkFairnessTrackerContention(b *testing.B) {
+	ctx := context.Background()
+	ids := make([][]byte, 1024)
+	for i := range ids {
+		ids[i] = []byte(fmt.Sprintf("client-%d", i))
+	}
+
+	for _, goroutines := range []int{1, 8, 64, 256} {
+		b.Run(fmt.Sprintf("parallelism=%d", goroutines), func(b *testing.B) {
+			trk, err := NewFairnessTrackerWithClockAndTicker(config.DefaultFairnessTrackerConfig(), utils.NewRealClock(), newFakeTicker())
+			require.NoError(b, err)
+			defer trk.Close()
+
+			var next atomic.Int64
+			b.SetParallelism(goroutines)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				result := &request.RegisterRequestResult{}
+				i := int(next.Add(1))
+				for pb.Next() {
+					trk.RegisterRequestInto(ctx, ids[i%len(ids)], result)
+					i++
+				}
+			})
+		})
+	}
+}
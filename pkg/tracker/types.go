@@ -4,20 +4,88 @@ import (
 	"time"
 
 	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
 	"github.com/satmihir/fair/pkg/utils"
 )
 
+// TrackerStats summarizes the activity of a tracker since it was created.
+type TrackerStats struct {
+	// Number of requests a decision was made for, including rate limited ones
+	Requests uint64
+	// Number of requests throttled, including those only throttled in the
+	// shadow throttle mode
+	Throttles uint64
+	// Number of outcomes applied to client flows. An outcome attributed to
+	// several flows, such as a tiered or resource outcome, counts once per flow.
+	Reports uint64
+	// The structures in rotation order, starting with the one making decisions
+	Generations []GenerationStats
+	// Time left until the next rotation
+	UntilNextRotation time.Duration
+}
+
+// GenerationStats identifies one of the structures in rotation.
+type GenerationStats struct {
+	// The ID of the structure
+	ID uint64
+	// The seed client identifiers are hashed with. Zero if the structure
+	// doesn't expose it.
+	Seed uint32
+}
+
 // FairnessTrackerBuilder helps configure and construct a FairnessTracker.
 type FairnessTrackerBuilder struct {
 	configuration *config.FairnessTrackerConfig
+	clock         utils.IClock
+}
+
+// Option configures a FairnessTrackerBuilder. Pass options to
+// NewFairnessTrackerBuilder.
+type Option func(*FairnessTrackerBuilder)
+
+// WithRotation sets how often the structures rotate and how many are kept in
+// rotation. A zero numGenerations keeps the default.
+func WithRotation(frequency time.Duration, numGenerations uint32) Option {
+	return func(bl *FairnessTrackerBuilder) {
+		bl.configuration.RotationFrequency = frequency
+		bl.configuration.NumGenerations = numGenerations
+	}
+}
+
+// WithStats includes result stats in every decision.
+func WithStats() Option {
+	return func(bl *FairnessTrackerBuilder) {
+		bl.configuration.IncludeStats = true
+	}
+}
+
+// WithAggregator sets the function choosing the final probability from the
+// bucket probabilities, such as one from the aggregators package.
+func WithAggregator(aggregator config.FinalProbabilityFunction) Option {
+	return func(bl *FairnessTrackerBuilder) {
+		bl.configuration.FinalProbabilityFunction = aggregator
+	}
+}
+
+// WithClock sets the clock the tracker reads time from. Rotations still
+// follow a real ticker.
+func WithClock(clock utils.IClock) Option {
+	return func(bl *FairnessTrackerBuilder) {
+		bl.clock = clock
+	}
 }
 
 // NewFairnessTrackerBuilder returns a new builder pre-populated with the
-// default configuration.
-func NewFairnessTrackerBuilder() *FairnessTrackerBuilder {
-	return &FairnessTrackerBuilder{
+// default configuration and the given options applied in order.
+func NewFairnessTrackerBuilder(opts ...Option) *FairnessTrackerBuilder {
+	bl := &FairnessTrackerBuilder{
 		configuration: config.DefaultFairnessTrackerConfig(),
 	}
+	for _, opt := range opts {
+		opt(bl)
+	}
+	return bl
 }
 
 // BuildWithDefaultConfig builds a tracker using DefaultFairnessTrackerConfig.
@@ -28,14 +96,25 @@ func (bl *FairnessTrackerBuilder) BuildWithDefaultConfig() (*FairnessTracker, er
 // BuildWithConfig builds a tracker using the supplied configuration.
 func (bl *FairnessTrackerBuilder) BuildWithConfig(configuration *config.FairnessTrackerConfig) (*FairnessTracker, error) {
 	if configuration == nil {
-		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil")
+		return nil, NewFairnessTrackerError(nil, "Configuration cannot be nil").WithSentinel(fairerrors.ErrNilConfig)
 	}
 	return NewFairnessTracker(configuration)
 }
 
-// Build constructs a tracker using the configuration accumulated on the builder.
+// Validate checks the configuration accumulated on the builder and returns the
+// error Build would, without building a tracker. Errors match
+// fairerrors.ErrInvalidConfig.
+func (bl *FairnessTrackerBuilder) Validate() error {
+	return validateConfigForRealTicker(bl.configuration)
+}
+
+// Build validates the configuration accumulated on the builder and constructs
+// a tracker using it.
 func (bl *FairnessTrackerBuilder) Build() (*FairnessTracker, error) {
-	return NewFairnessTracker(bl.configuration)
+	if err := bl.Validate(); err != nil {
+		return nil, err
+	}
+	return NewFairnessTrackerWithClockAndTicker(bl.configuration, bl.clock, utils.NewRealTicker(bl.configuration.RotationFrequency))
 }
 
 // SetL sets the number of levels used by the tracker.
@@ -63,6 +142,18 @@ func (bl *FairnessTrackerBuilder) SetLambda(Lambda float64) {
 	bl.configuration.Lambda = Lambda
 }
 
+// SetHashSeed makes the hash seeds of the structures reproducible. Zero picks
+// random seeds.
+func (bl *FairnessTrackerBuilder) SetHashSeed(hashSeed uint32) {
+	bl.configuration.HashSeed = hashSeed
+}
+
+// SetDecayFunction sets how bucket probabilities decay over time. Lambda is
+// passed to the function as its rate.
+func (bl *FairnessTrackerBuilder) SetDecayFunction(decayFunction config.DecayFunction) {
+	bl.configuration.DecayFunction = decayFunction
+}
+
 // SetIncludeStats indicates whether the tracker should return detailed stats.
 func (bl *FairnessTrackerBuilder) SetIncludeStats(IncludeStats bool) {
 	bl.configuration.IncludeStats = IncludeStats
@@ -73,12 +164,116 @@ func (bl *FairnessTrackerBuilder) SetRotationFrequency(rotationFrequency time.Du
 	bl.configuration.RotationFrequency = rotationFrequency
 }
 
+// SetNumGenerations sets the number of structures kept in rotation.
+func (bl *FairnessTrackerBuilder) SetNumGenerations(numGenerations uint32) {
+	bl.configuration.NumGenerations = numGenerations
+}
+
 // SetFinalProbabilityFunction sets the function used to derive the final
 // throttling probability from all buckets.
 func (bl *FairnessTrackerBuilder) SetFinalProbabilityFunction(finalProbabilityFunction config.FinalProbabilityFunction) {
 	bl.configuration.FinalProbabilityFunction = finalProbabilityFunction
 }
 
+// SetDecisionMode sets how the final probability is turned into a throttling
+// decision. The threshold is only used in the threshold decision mode.
+func (bl *FairnessTrackerBuilder) SetDecisionMode(decisionMode config.DecisionMode, threshold float64) {
+	bl.configuration.DecisionMode = decisionMode
+	bl.configuration.DecisionThreshold = threshold
+}
+
+// SetMinPassRate sets the share of throttled requests that are let through
+// anyway so fully throttled clients can recover. Zero disables it.
+func (bl *FairnessTrackerBuilder) SetMinPassRate(minPassRate float64) {
+	bl.configuration.MinPassRate = minPassRate
+}
+
+// SetThrottleMode sets what the tracker does with a positive throttling decision.
+func (bl *FairnessTrackerBuilder) SetThrottleMode(throttleMode config.ThrottleMode) {
+	bl.configuration.ThrottleMode = throttleMode
+}
+
+// SetMaxRetryAfter sets the retry-after suggested for fully throttled flows in
+// the delay throttle mode.
+func (bl *FairnessTrackerBuilder) SetMaxRetryAfter(maxRetryAfter time.Duration) {
+	bl.configuration.MaxRetryAfter = maxRetryAfter
+}
+
+// SetTopThrottledClientsCapacity sets how many clients the most throttled
+// clients sketch tracks. Zero disables tracking.
+func (bl *FairnessTrackerBuilder) SetTopThrottledClientsCapacity(capacity uint32) {
+	bl.configuration.TopThrottledClientsCapacity = capacity
+}
+
+// SetRateLimit enables an absolute per-client rate limit of maxRPS requests per
+// second with the given burst, enforced before the fairness decision.
+func (bl *FairnessTrackerBuilder) SetRateLimit(maxRPS float64, burst uint32) {
+	bl.configuration.MaxRPS = maxRPS
+	bl.configuration.Burst = burst
+}
+
+// SetDecisionCache enables caching the final probability of up to size clients
+// for the given TTL, so very hot clients skip the buckets.
+func (bl *FairnessTrackerBuilder) SetDecisionCache(size uint32, ttl time.Duration) {
+	bl.configuration.DecisionCacheSize = size
+	bl.configuration.DecisionCacheTTL = ttl
+}
+
+// SetPendingRequestTTL enables tracking admitted requests by token until their
+// outcome is reported, timing them out after the given TTL.
+func (bl *FairnessTrackerBuilder) SetPendingRequestTTL(ttl time.Duration) {
+	bl.configuration.PendingRequestTTL = ttl
+}
+
+// SetResourceBlastRadius enables attributing outcomes of shared resources to
+// up to blastRadius of their heaviest recent clients.
+func (bl *FairnessTrackerBuilder) SetResourceBlastRadius(blastRadius uint32) {
+	bl.configuration.ResourceBlastRadius = blastRadius
+}
+
+// SetTierWeights sets the weights of the tenant and the user in the final
+// probability of requests registered with RegisterTieredRequest.
+func (bl *FairnessTrackerBuilder) SetTierWeights(tenantWeight, userWeight float64) {
+	bl.configuration.TenantWeight = tenantWeight
+	bl.configuration.UserWeight = userWeight
+}
+
+// SetIdentifierNormalizer sets the function rewriting client identifiers
+// before they are tracked.
+func (bl *FairnessTrackerBuilder) SetIdentifierNormalizer(normalizer func(clientIdentifier []byte) []byte) {
+	bl.configuration.IdentifierNormalizer = normalizer
+}
+
+// SetObserver sets the observer notified of tracker events.
+func (bl *FairnessTrackerBuilder) SetObserver(observer config.Observer) {
+	bl.configuration.Observer = observer
+}
+
+// SetOutcomeMultiplier sets the multiplier applied to Pi when the given
+// failure-like outcome is reported.
+func (bl *FairnessTrackerBuilder) SetOutcomeMultiplier(outcome request.Outcome, multiplier float64) {
+	if bl.configuration.OutcomeMultipliers == nil {
+		bl.configuration.OutcomeMultipliers = make(map[request.Outcome]float64)
+	}
+	bl.configuration.OutcomeMultipliers[outcome] = multiplier
+}
+
+// SetPriorityMultiplier sets the multiplier applied to the final probability
+// of requests of the given priority.
+func (bl *FairnessTrackerBuilder) SetPriorityMultiplier(priority request.Priority, multiplier float64) {
+	if bl.configuration.PriorityMultipliers == nil {
+		bl.configuration.PriorityMultipliers = make(map[request.Priority]float64)
+	}
+	bl.configuration.PriorityMultipliers[priority] = multiplier
+}
+
+// SetLatencyThresholds sets the latencies at which ReportLatency starts
+// reporting partial failures and reports full failures.
+func (bl *FairnessTrackerBuilder) SetLatencyThresholds(target, limit time.Duration) {
+	bl.configuration.LatencyTarget = target
+	bl.configuration.LatencyLimit = limit
+}
+
 // FairnessTrackerError is returned when the tracker encounters a recoverable
 // error that should be surfaced to the caller.
 type FairnessTrackerError struct {
@@ -92,3 +287,10 @@ func NewFairnessTrackerError(wrapped error, msg string, args ...any) *FairnessTr
 		BaseError: utils.NewBaseError(wrapped, msg, args...),
 	}
 }
+
+// WithSentinel marks the error as an instance of the given sentinel from the
+// fairerrors package so that errors.Is matches it.
+func (e *FairnessTrackerError) WithSentinel(sentinel error) *FairnessTrackerError {
+	e.BaseError.WithSentinel(sentinel)
+	return e
+}
@@ -1,13 +1,18 @@
 package tracker
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/satmihir/fair/pkg/config"
+	"github.com/satmihir/fair/pkg/config/decay"
+	"github.com/satmihir/fair/pkg/fairerrors"
+	"github.com/satmihir/fair/pkg/request"
 	"github.com/satmihir/fair/pkg/testutils"
 )
 
@@ -25,16 +30,51 @@ func TestBuildFairnessTracker(t *testing.T) {
 	b.SetPd(.1)
 	b.SetPi(.2)
 	b.SetLambda(.001)
+	b.SetDecayFunction(decay.Linear)
+	b.SetHashSeed(42)
 	b.SetRotationFrequency(1 * time.Second)
 	b.SetIncludeStats(true)
 	b.SetFinalProbabilityFunction(config.MeanFinalProbabilityFunction)
+	b.SetThrottleMode(config.ThrottleModeDelay)
+	b.SetDecisionMode(config.DecisionModeThreshold, 0.8)
+	b.SetMinPassRate(0.01)
+	b.SetMaxRetryAfter(3 * time.Second)
+	b.SetOutcomeMultiplier(request.OutcomeTimeout, 2)
+	b.SetPriorityMultiplier(request.PriorityLow, 2)
+	b.SetLatencyThresholds(100*time.Millisecond, time.Second)
+	b.SetDecisionCache(100, 10*time.Millisecond)
+	b.SetPendingRequestTTL(30 * time.Second)
+	b.SetResourceBlastRadius(5)
+	b.SetTierWeights(1, 3)
+	b.SetIdentifierNormalizer(bytes.ToLower)
+	b.SetNumGenerations(3)
 
 	tr, err := b.Build()
-	assert.NoError(t, err)
-	assert.Equal(t, int(tr.trackerConfig.L), 10)
-	assert.Equal(t, int(tr.trackerConfig.M), 10)
-	assert.Equal(t, 1*time.Second, tr.trackerConfig.RotationFrequency,
+	require.NoError(t, err)
+	defer tr.Close()
+	assert.Equal(t, int(tr.current.Load().config.L), 10)
+	assert.Equal(t, int(tr.current.Load().config.M), 10)
+	assert.Equal(t, 1*time.Second, tr.current.Load().config.RotationFrequency,
 		"rotation frequency should match the value set via builder")
+	assert.Equal(t, config.ThrottleModeDelay, tr.current.Load().config.ThrottleMode)
+	assert.Equal(t, config.DecisionModeThreshold, tr.current.Load().config.DecisionMode)
+	assert.Equal(t, 0.8, tr.current.Load().config.DecisionThreshold)
+	assert.Equal(t, uint32(42), tr.current.Load().config.HashSeed)
+	assert.Equal(t, 0.5, tr.current.Load().config.DecayFunction(0.6, 0.1, time.Second), "should use linear decay")
+	assert.Equal(t, 0.01, tr.current.Load().config.MinPassRate)
+	assert.Equal(t, 3*time.Second, tr.current.Load().config.MaxRetryAfter)
+	assert.Equal(t, map[request.Outcome]float64{request.OutcomeTimeout: 2}, tr.current.Load().config.OutcomeMultipliers)
+	assert.Equal(t, map[request.Priority]float64{request.PriorityLow: 2}, tr.current.Load().config.PriorityMultipliers)
+	assert.Equal(t, 100*time.Millisecond, tr.current.Load().config.LatencyTarget)
+	assert.Equal(t, time.Second, tr.current.Load().config.LatencyLimit)
+	assert.Equal(t, uint32(100), tr.current.Load().config.DecisionCacheSize)
+	assert.Equal(t, 10*time.Millisecond, tr.current.Load().config.DecisionCacheTTL)
+	assert.Equal(t, 30*time.Second, tr.current.Load().config.PendingRequestTTL)
+	assert.Equal(t, uint32(5), tr.current.Load().config.ResourceBlastRadius)
+	assert.Equal(t, 1.0, tr.current.Load().config.TenantWeight)
+	assert.Equal(t, 3.0, tr.current.Load().config.UserWeight)
+	assert.NotNil(t, tr.current.Load().config.IdentifierNormalizer)
+	assert.Len(t, tr.current.Load().generations, 3)
 }
 
 func TestBuildWithConfig(t *testing.T) {
@@ -42,7 +82,52 @@ func TestBuildWithConfig(t *testing.T) {
 	assert.NoError(t, err)
 	b := NewFairnessTrackerBuilder()
 	tr, err := b.BuildWithConfig(c)
-	assert.NoError(t, err)
-	assert.Equal(t, int(tr.trackerConfig.L), 4)
-	assert.Equal(t, int(tr.trackerConfig.M), 10)
+	require.NoError(t, err)
+	defer tr.Close()
+	assert.Equal(t, int(tr.current.Load().config.L), 4)
+	assert.Equal(t, int(tr.current.Load().config.M), 10)
+}
+
+func TestNewFairnessTrackerBuilder_Options(t *testing.T) {
+	clk := newFakeClock()
+	b := NewFairnessTrackerBuilder(
+		WithRotation(time.Minute, 3),
+		WithStats(),
+		WithAggregator(config.MeanFinalProbabilityFunction),
+		WithClock(clk),
+	)
+
+	tr, err := b.Build()
+	require.NoError(t, err)
+	defer tr.Close()
+	conf := tr.current.Load().config
+	assert.Equal(t, time.Minute, conf.RotationFrequency)
+	assert.Len(t, tr.current.Load().generations, 3)
+	assert.True(t, conf.IncludeStats)
+	assert.Equal(t, 0.5, conf.FinalProbabilityFunction([]float64{0, 1}), "should use the mean aggregator")
+	assert.Same(t, clk, tr.clock)
+}
+
+func TestFairnessTrackerBuilder_Validate(t *testing.T) {
+	testCases := map[string]Option{
+		"no rotation":        WithRotation(0, 0),
+		"one generation":     WithRotation(time.Minute, 1),
+		"structure config":   func(bl *FairnessTrackerBuilder) { bl.SetPi(0) },
+		"tracker config":     func(bl *FairnessTrackerBuilder) { bl.SetPendingRequestTTL(-time.Second) },
+		"no decision cache":  func(bl *FairnessTrackerBuilder) { bl.SetDecisionCache(10, 0) },
+		"negative rate":      func(bl *FairnessTrackerBuilder) { bl.SetRateLimit(-1, 1) },
+		"invalid multiplier": func(bl *FairnessTrackerBuilder) { bl.SetPriorityMultiplier(request.PriorityLow, -1) },
+	}
+
+	require.NoError(t, NewFairnessTrackerBuilder().Validate())
+	for name, opt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := NewFairnessTrackerBuilder(opt)
+
+			require.ErrorIs(t, b.Validate(), fairerrors.ErrInvalidConfig)
+			tr, err := b.Build()
+			require.ErrorIs(t, err, fairerrors.ErrInvalidConfig)
+			require.Nil(t, tr)
+		})
+	}
 }
@@ -7,6 +7,8 @@ import "fmt"
 type BaseError struct {
 	msg          string
 	wrappedError error
+	// The sentinel this error matches with errors.Is, if any
+	sentinel error
 }
 
 // NewBaseError creates a new BaseError that wraps an underlying error with a
@@ -29,3 +31,15 @@ func (be *BaseError) Error() string {
 func (be *BaseError) Unwrap() error {
 	return be.wrappedError
 }
+
+// WithSentinel marks the error as an instance of the given sentinel so that
+// errors.Is matches it, without changing the message or the wrapped error.
+func (be *BaseError) WithSentinel(sentinel error) *BaseError {
+	be.sentinel = sentinel
+	return be
+}
+
+// Is reports whether target is the sentinel the error was marked with.
+func (be *BaseError) Is(target error) bool {
+	return be.sentinel != nil && target == be.sentinel
+}
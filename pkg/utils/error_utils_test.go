@@ -15,3 +15,19 @@ func TestBaseError(t *testing.T) {
 	assert.Equal(t, testError.Error(), "wrapping text xyz: wrapped")
 	assert.Equal(t, errors.Unwrap(testError), e)
 }
+
+func TestBaseError_WithSentinel(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	other := errors.New("other")
+	wrapped := fmt.Errorf("wrapped")
+
+	testError := NewBaseError(wrapped, "wrapping text").WithSentinel(sentinel)
+
+	assert.Equal(t, "wrapping text: wrapped", testError.Error())
+	assert.Equal(t, wrapped, errors.Unwrap(testError))
+	assert.ErrorIs(t, testError, sentinel)
+	assert.ErrorIs(t, testError, wrapped)
+	assert.NotErrorIs(t, testError, other)
+	assert.ErrorIs(t, fmt.Errorf("outer: %w", testError), sentinel)
+	assert.NotErrorIs(t, NewBaseError(nil, "plain"), sentinel)
+}
@@ -34,6 +34,8 @@ func (c *Clock) Sleep(duration time.Duration) {
 type ITicker interface {
 	C() <-chan time.Time
 	Stop()
+	// Reset changes the ticker period to the given duration
+	Reset(duration time.Duration)
 }
 
 // Ticker wraps time.Ticker to satisfy the ITicker interface.
@@ -57,3 +59,8 @@ func (t *Ticker) C() <-chan time.Time {
 func (t *Ticker) Stop() {
 	t.ticker.Stop()
 }
+
+// Reset stops the ticker and resets its period to the specified duration.
+func (t *Ticker) Reset(duration time.Duration) {
+	t.ticker.Reset(duration)
+}
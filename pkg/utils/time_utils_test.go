@@ -31,3 +31,19 @@ func TestTicker(t *testing.T) {
 
 	assert.True(t, found)
 }
+
+func TestTickerReset(t *testing.T) {
+	var ticker ITicker = NewRealTicker(time.Hour)
+	defer ticker.Stop()
+	var found bool
+
+	ticker.Reset(10 * time.Millisecond)
+
+	select {
+	case <-ticker.C():
+		found = true
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.True(t, found)
+}